@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	DefaultPath         = "config.json"
+	defaultDatabasePath = "data/we-api.json"
+)
+
+// Pricing 模型价格，单位：美元 / 百万 token
+type Pricing struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	AudioInput  float64 `json:"audio_input,omitempty"`  //音频输入的价格，为空时按 input 计费
+	AudioOutput float64 `json:"audio_output,omitempty"` //音频输出的价格，为空时按 output 计费
+	Minute      float64 `json:"minute,omitempty"`       //音频转写的价格，单位美元 / 分钟
+	Character   float64 `json:"character,omitempty"`    //语音合成的价格，单位美元 / 百万字符
+	// 每张图片的价格，单位美元，key 为尺寸或者 质量:尺寸，例如 1024x1024 hd:1024x1024
+	Image map[string]float64 `json:"image,omitempty"`
+}
+
+type Model struct {
+	Name          string    `json:"name"`           //对外暴露的模型名
+	Aliases       []string  `json:"aliases"`        //别名，解析到同一个模型
+	Type          string    `json:"type"`           //服务商类型 openai anthropic gemini
+	BaseURL       string    `json:"base_url"`       //上游地址，为空时使用服务商官方地址
+	UpstreamModel string    `json:"upstream_model"` //上游实际的模型名，为空时与 Name 相同
+	Capabilities  []string  `json:"capabilities"`   //模型能力 chat vision tools ...
+	Pricing       *Pricing  `json:"pricing"`        //按金额计费时使用
+	OwnedBy       string    `json:"owned_by"`       ///v1/models 中展示的所有者，为空时按服务商类型
+	Created       int64     `json:"created"`        ///v1/models 中展示的创建时间戳，为空时使用启动时间
+	Retry         *Retry    `json:"retry"`          //重试策略，未配置的字段使用全局配置
+	Timeout       int       `json:"timeout"`        //请求上游的总超时时间，包括读取流式响应，单位秒，为空时不限制
+	Timeouts      *Timeouts `json:"timeouts"`       //各阶段的超时时间，未配置的字段使用全局配置
+}
+
+type Channel struct {
+	Id       int               `json:"id"`
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`     //服务商类型，与模型的 type 对应
+	BaseURL  string            `json:"base_url"` //上游地址，为空时使用模型配置的地址
+	Keys     []string          `json:"keys"`     //上游 API Key，多个时按负载均衡策略选择
+	Headers  map[string]string `json:"headers"`  //额外的请求头
+	Models   []string          `json:"models"`   //可服务的模型名，为空时可服务同类型的所有模型
+	Enabled  *bool             `json:"enabled"`  //未配置时默认启用
+	Priority int               `json:"priority"` //优先级，数值大的优先，同一优先级的渠道都不可用时才使用低优先级的
+	Weight   int               `json:"weight"`   //同一优先级内按权重随机时的权重，默认 1
+	Timeouts *Timeouts         `json:"timeouts"` //各阶段的超时时间，优先于模型的配置
+}
+
+// BalancerGroup 一组模型使用相同的渠道选择策略
+type BalancerGroup struct {
+	Models   []string `json:"models"`   //模型名或别名
+	Strategy string   `json:"strategy"` //weighted least_inflight latency
+}
+
+// Balancer 同一个模型有多个渠道时的选择策略，同一渠道的多个 key 也按该策略选择
+type Balancer struct {
+	Strategy string          `json:"strategy"` //默认策略，为空时为 weighted
+	Groups   []BalancerGroup `json:"groups"`
+}
+
+// Retry 上游请求失败时的重试策略，时间单位毫秒
+type Retry struct {
+	MaxAttempts int `json:"max_attempts"` //最多请求次数，包括第一次，默认 3，1 表示不重试
+	BaseDelay   int `json:"base_delay"`   //第一次重试前的等待时间，之后每次翻倍，默认 500
+	MaxDelay    int `json:"max_delay"`    //单次等待时间的上限，重试同一个渠道和 key 时 Retry-After 超过该值则不再重试，默认 10000
+}
+
+// Timeouts 请求上游各阶段的超时时间，时间单位毫秒
+type Timeouts struct {
+	Connect    int `json:"connect"`     //建立连接，包括 DNS 解析和 TLS 握手，默认 10000
+	Header     int `json:"header"`      //发出请求后等待响应头，非流式请求包括生成的时间，默认不限制
+	FirstToken int `json:"first_token"` //流式请求从发出请求到收到第一个带有生成内容的事件，默认不限制
+	Idle       int `json:"idle"`        //读取响应时两次收到数据的最长间隔，默认 120000
+}
+
+type Quota struct {
+	Mode   string  `json:"mode"`    //计费方式 token：按 token 数计费 money：按金额计费
+	PerUSD float64 `json:"per_usd"` //按金额计费时 1 美元对应的额度
+	Image  int64   `json:"image"`   //按 token 计费时每张生成的图片对应的额度，默认 1000
+}
+
+type Image struct {
+	MaxSize      int64    `json:"max_size"`      //图片大小限制，单位字节，默认 20MB
+	AllowedHosts []string `json:"allowed_hosts"` //允许下载图片的域名，支持 *.example.com，为空时允许所有公网地址
+}
+
+type Config struct {
+	Database string    `json:"database"` //本地数据库文件路径，默认 data/we-api.json
+	Quota    Quota     `json:"quota"`
+	Image    Image     `json:"image"`
+	Retry    Retry     `json:"retry"`
+	Timeouts Timeouts  `json:"timeouts"`
+	Balancer Balancer  `json:"balancer"`
+	Models   []Model   `json:"models"`
+	Channels []Channel `json:"channels"`
+}
+
+func (c *Config) DatabasePath() string {
+	if c.Database == "" {
+		return defaultDatabasePath
+	}
+	return c.Database
+}
+
+// Path 配置文件路径，可通过环境变量 WE_API_CONFIG 指定
+func Path() string {
+	if path := os.Getenv("WE_API_CONFIG"); path != "" {
+		return path
+	}
+	return DefaultPath
+}
+
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file failed: %w", err)
+	}
+
+	var cfg Config
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config file %s failed: %w", path, err)
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,13 @@
+package ctxkey
+
+// gin.Context 中保存的键
+const (
+	Id          = "id"
+	TokenId     = "token_id"
+	TokenName   = "token_name"
+	IsAdmin     = "is_admin"
+	TokenModels = "token_models"
+	QueryKey    = "query_key" //从 URL 中移除的 key 查询参数
+	// 读取上游响应时发生的超时错误
+	UpstreamTimeout = "upstream_timeout"
+)
@@ -0,0 +1,51 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path"
+	"strings"
+)
+
+// 无法解析时长的格式按 128kbps 估算
+const defaultAudioBytesPerSecond = 16000
+
+// AudioDuration 估算音频时长，单位秒。wav 从文件头读取，其它格式按码率估算
+func AudioDuration(data []byte, fileName string) float64 {
+	if strings.ToLower(path.Ext(fileName)) == ".wav" || bytes.HasPrefix(data, []byte("RIFF")) {
+		if duration, ok := wavDuration(data); ok {
+			return duration
+		}
+	}
+	return float64(len(data)) / defaultAudioBytesPerSecond
+}
+
+// wavDuration 读取 fmt 块中的 byte rate，用数据长度除以它得到时长
+func wavDuration(data []byte) (float64, bool) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, false
+	}
+
+	var byteRate uint32
+	for offset := 12; offset+8 <= len(data); {
+		chunkID := string(data[offset : offset+4])
+		chunkSize := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		body := offset + 8
+		switch chunkID {
+		case "fmt ":
+			if body+12 > len(data) {
+				return 0, false
+			}
+			byteRate = binary.LittleEndian.Uint32(data[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, false
+			}
+			// 流式录制的 wav 数据长度可能没有回填，以实际长度为准
+			size := min(int(chunkSize), len(data)-body)
+			return float64(size) / float64(byteRate), true
+		}
+		offset = body + int(chunkSize) + int(chunkSize%2)
+	}
+	return 0, false
+}
@@ -0,0 +1,178 @@
+package media
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/xiaoxiongmao5/we-api/common/config"
+)
+
+const (
+	defaultMaxImageSize = 20 << 20
+	downloadTimeout     = 30 * time.Second
+	maxImageRedirects   = 3
+)
+
+var (
+	ErrImageTooLarge   = errors.New("image is too large")
+	ErrHostNotAllowed  = errors.New("image host is not allowed")
+	ErrNotImage        = errors.New("content is not an image")
+	ErrInvalidImageURL = errors.New("invalid image url")
+)
+
+var settings = config.Image{MaxSize: defaultMaxImageSize}
+
+func Init(image config.Image) {
+	if image.MaxSize <= 0 {
+		image.MaxSize = defaultMaxImageSize
+	}
+	settings = image
+}
+
+// 下载图片时拒绝连接内网地址，在建立连接时检查可以防止 DNS 解析结果被替换。
+// 不使用环境变量中的代理，经过代理时连接的是代理的地址，无法检查目标地址；每次重定向都重新检查地址
+var imageClient = &http.Client{
+	Timeout: downloadTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxImageRedirects {
+			return errors.New("too many redirects")
+		}
+		return checkImageURL(req.URL)
+	},
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+					return ErrHostNotAllowed
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// hostAllowed 未配置白名单时允许所有公网地址，支持 *.example.com 的写法
+func hostAllowed(host string) bool {
+	if len(settings.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range settings.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok && strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImageURL 只允许 http(s) 和白名单中的域名
+func checkImageURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrInvalidImageURL
+	}
+	if !hostAllowed(u.Hostname()) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Hostname())
+	}
+	return nil
+}
+
+// GetImage 读取 data URI 或者下载 http(s) 图片，返回 MIME 类型和 base64 编码的数据
+func GetImage(ctx context.Context, imageURL string) (mimeType string, data string, err error) {
+	if strings.HasPrefix(imageURL, "data:") {
+		return parseDataURI(imageURL)
+	}
+
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return "", "", ErrInvalidImageURL
+	}
+	if err = checkImageURL(u); err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("download image failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("download image failed: status code %d", resp.StatusCode)
+	}
+	if resp.ContentLength > settings.MaxSize {
+		return "", "", ErrImageTooLarge
+	}
+
+	// 多读一个字节用来判断是否超过大小限制
+	content, err := io.ReadAll(io.LimitReader(resp.Body, settings.MaxSize+1))
+	if err != nil {
+		return "", "", fmt.Errorf("download image failed: %w", err)
+	}
+	if int64(len(content)) > settings.MaxSize {
+		return "", "", ErrImageTooLarge
+	}
+
+	mimeType = detectImageType(content, resp.Header.Get("Content-Type"))
+	if mimeType == "" {
+		return "", "", ErrNotImage
+	}
+	return mimeType, base64.StdEncoding.EncodeToString(content), nil
+}
+
+// parseDataURI 解析 data:image/png;base64,xxx 格式
+func parseDataURI(dataURI string) (string, string, error) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(dataURI, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", "", ErrInvalidImageURL
+	}
+
+	content, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidImageURL, err.Error())
+	}
+	if int64(len(content)) > settings.MaxSize {
+		return "", "", ErrImageTooLarge
+	}
+
+	mimeType := detectImageType(content, strings.TrimSuffix(header, ";base64"))
+	if mimeType == "" {
+		return "", "", ErrNotImage
+	}
+	return mimeType, data, nil
+}
+
+// detectImageType 优先根据内容判断类型，判断不出时使用声明的类型
+func detectImageType(content []byte, declared string) string {
+	if detected := http.DetectContentType(content); strings.HasPrefix(detected, "image/") {
+		return detected
+	}
+	declared, _, _ = strings.Cut(declared, ";")
+	declared = strings.TrimSpace(strings.ToLower(declared))
+	if strings.HasPrefix(declared, "image/") {
+		return declared
+	}
+	return ""
+}
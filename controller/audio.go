@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common"
+	"github.com/xiaoxiongmao5/we-api/common/media"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/relay/billing"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+// 与 OpenAI 一致，上传的音频文件最大 25MB
+const maxAudioFileSize = 25 << 20
+
+// RelayAudioHandler 处理语音合成、转写和翻译
+func RelayAudioHandler(c *gin.Context) {
+	meta := meta.GetByContext(c)
+	ctx := c.Request.Context()
+	logger := utils.Log(ctx, "RelayAudioHandler")
+
+	var (
+		modelName   string
+		requestBody []byte
+		quota       int64
+	)
+	speechRequest := &model.TextToSpeechRequest{}
+	audioRequest := &model.AudioRequest{}
+	if meta.Mode == relaymode.AudioSpeech {
+		err := common.UnmarshalBody(c, &speechRequest)
+		if err != nil || speechRequest == nil {
+			logger.Error("UnmarshalBody err", xlog.Err(err))
+			renderError(c, invalidRequestError("request body is invalid", ""))
+			return
+		}
+		if speechRequest.Input == "" {
+			renderError(c, invalidRequestError("input is required", "input"))
+			return
+		}
+		modelName = speechRequest.Model
+	} else {
+		var relayErr *model.ErrorWithStatusCode
+		audioRequest, relayErr = parseAudioRequest(c)
+		if relayErr != nil {
+			renderError(c, relayErr)
+			return
+		}
+		modelName = audioRequest.Model
+	}
+	if modelName == "" {
+		renderError(c, invalidRequestError("model is required", "model"))
+		return
+	}
+	meta.FullMode = modelName
+
+	if relayErr := setupMeta(meta, modelName); relayErr != nil {
+		renderError(c, relayErr)
+		return
+	}
+
+	modelInfo, _ := registry.Resolve(meta.FullMode)
+	defer withModelTimeout(c, modelInfo)()
+	adaptorImpl := GetAdaptor(meta.APIType)
+	if adaptorImpl == nil {
+		renderError(c, openai.ErrorWrapper(fmt.Errorf("invalid api type: %s", meta.APIType), "invalid_api_type", http.StatusInternalServerError))
+		return
+	}
+
+	if meta.Mode == relaymode.AudioSpeech {
+		if !apitype.Speech[modelInfo.Type] || !modelInfo.Support(registry.CapabilitySpeech) {
+			renderError(c, capabilityError(modelInfo.Name, registry.CapabilitySpeech))
+			return
+		}
+		// 语音合成按输入的字符数计费
+		quota = billing.SpeechCost(modelInfo, utf8.RuneCountInString(speechRequest.Input))
+		speechRequest.Model = meta.ActualModelName
+		jsonData, err := json.Marshal(speechRequest)
+		if err != nil {
+			renderError(c, openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError))
+			return
+		}
+		requestBody = jsonData
+	} else {
+		if !apitype.Transcription[modelInfo.Type] || !modelInfo.Support(registry.CapabilityTranscription) {
+			renderError(c, capabilityError(modelInfo.Name, registry.CapabilityTranscription))
+			return
+		}
+		// 先按文件估算的时长预扣，上游返回实际时长后多退少补
+		quota = billing.AudioDurationCost(modelInfo, media.AudioDuration(audioRequest.File, audioRequest.FileName))
+		audioRequest.Model = meta.ActualModelName
+		reader, err := adaptorImpl.ConvertAudioRequest(c, meta, audioRequest)
+		if err != nil {
+			renderError(c, openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest))
+			return
+		}
+		// 重试时重新发送，表单需要完整缓存
+		if requestBody, err = io.ReadAll(reader); err != nil {
+			renderError(c, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError))
+			return
+		}
+	}
+
+	if relayErr := billing.PreConsume(meta, quota); relayErr != nil {
+		renderError(c, relayErr)
+		return
+	}
+
+	// 失败时按模型的重试策略换渠道重试
+	resp, relayErr := doRequest(c, adaptorImpl, meta, modelInfo, requestBody)
+	if relayErr != nil {
+		billing.Refund(ctx, meta)
+		renderError(c, relayErr)
+		return
+	}
+	defer resp.Body.Close()
+
+	usage, respErr := adaptorImpl.DoResponse(c, resp, meta)
+	if respErr != nil {
+		respErr = timeoutError(c, respErr)
+		logger.Error("respErr is not nil", xlog.Any("respErr", respErr))
+		// 语音已经开始输出时按预扣额度计费
+		if c.Writer.Written() {
+			return
+		}
+		billing.Refund(ctx, meta)
+		renderError(c, respErr)
+		return
+	}
+
+	billing.PostConsume(ctx, meta, usage)
+}
+
+// parseAudioRequest 解析转写和翻译接口的 multipart 表单
+func parseAudioRequest(c *gin.Context) (*model.AudioRequest, *model.ErrorWithStatusCode) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAudioFileSize+1<<20)
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		return nil, invalidRequestError(fmt.Sprintf("invalid multipart form: %s", err.Error()), "file")
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, invalidRequestError("file is required", "file")
+	}
+	if fileHeader.Size > maxAudioFileSize {
+		return nil, invalidRequestError("file is too large", "file")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, invalidRequestError(err.Error(), "file")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, invalidRequestError(err.Error(), "file")
+	}
+
+	request := &model.AudioRequest{
+		File:     data,
+		FileName: fileHeader.Filename,
+		Fields:   make(url.Values),
+	}
+	for k, values := range c.Request.MultipartForm.Value {
+		if len(values) == 0 {
+			continue
+		}
+		switch k {
+		case "model":
+			request.Model = values[0]
+		case "response_format":
+			request.ResponseFormat = values[0]
+		default:
+			request.Fields[k] = values
+		}
+	}
+	return request, nil
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/relay/channel"
+)
+
+type channelStatus struct {
+	Id      int                   `json:"id"`
+	Name    string                `json:"name"`
+	Type    string                `json:"type"`
+	Enabled bool                  `json:"enabled"` //配置中是否启用
+	Status  channel.BreakerStatus `json:"status"`  //熔断器状态，open 表示被自动停用
+	Keys    []channel.KeyStatus   `json:"keys"`
+	// 负载统计
+	InFlight int64 `json:"in_flight"`            //进行中的请求数
+	Latency  int64 `json:"latency_ms,omitempty"` //首 token 延迟的 EWMA，单位毫秒
+}
+
+// ListChannels 列出渠道和自动停用的状态，上游的 key 不会完整返回
+func ListChannels(c *gin.Context) {
+	channels := channel.Channels()
+	data := make([]channelStatus, 0, len(channels))
+	for _, ch := range channels {
+		status, keys := ch.Status()
+		stats := ch.Stats()
+		latency, _ := stats.Latency()
+		data = append(data, channelStatus{
+			Id:       ch.Id,
+			Name:     ch.Name,
+			Type:     ch.Type,
+			Enabled:  ch.IsEnabled(),
+			Status:   status,
+			Keys:     keys,
+			InFlight: stats.InFlight(),
+			Latency:  latency.Milliseconds(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
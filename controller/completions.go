@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+// RelayCompletionsHandler 处理旧版的 /v1/completions 请求。
+// 模型声明了 completions 能力且上游支持时直接透传，否则把 prompt 包装成一条用户消息按对话请求转发，响应再转换成 text_completion 格式
+func RelayCompletionsHandler(c *gin.Context) {
+	meta := meta.GetByContext(c)
+	ctx := c.Request.Context()
+	logger := utils.Log(ctx, "RelayCompletionsHandler")
+	var completionsRequest *model.CompletionsRequest
+	err := common.UnmarshalBody(c, &completionsRequest)
+	if err != nil || completionsRequest == nil {
+		logger.Error("UnmarshalBody err", xlog.Err(err))
+		renderError(c, invalidRequestError("request body is invalid", ""))
+		return
+	}
+	textRequest := &completionsRequest.GeneralOpenAIRequest
+	textRequest.CompletionLogprobs = completionsRequest.Logprobs
+	if textRequest.Prompt == nil {
+		renderError(c, invalidRequestError("prompt is required", "prompt"))
+		return
+	}
+
+	if modelInfo, ok := registry.Resolve(textRequest.Model); ok && apitype.Completions[modelInfo.Type] && modelInfo.Support(registry.CapabilityCompletions) {
+		if relayErr := relayText(c, meta, textRequest); relayErr != nil && !c.Writer.Written() {
+			renderError(c, relayErr)
+		}
+		return
+	}
+
+	chatRequest, err := openai.ConvertCompletionsRequest(textRequest)
+	if err != nil {
+		renderError(c, invalidRequestError(err.Error(), ""))
+		return
+	}
+	// 转换后按对话请求转发
+	meta.Mode = relaymode.ChatCompletions
+	w := openai.NewCompletionsWriter(c, meta, textRequest)
+	relayErr := relayText(c, meta, chatRequest)
+	w.Finish(relayErr)
+}
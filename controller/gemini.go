@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/gemini"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+// RelayGeminiHandler 接收 Gemini 格式的 /v1beta/models/{model}:generateContent 和 :streamGenerateContent 请求，
+// 转换成 OpenAI 格式后可以转发给任意上游，响应再转回 Gemini 格式
+func RelayGeminiHandler(c *gin.Context) {
+	meta := meta.GetByContext(c)
+	// 转换后按对话请求转发
+	meta.Mode = relaymode.ChatCompletions
+	logger := utils.Log(c.Request.Context(), "RelayGeminiHandler")
+
+	// 路径参数形如 gemini-2.0-flash:generateContent，模型名中也可能有冒号
+	param := c.Param("model")
+	modelName, action := param, ""
+	if i := strings.LastIndex(param, ":"); i >= 0 {
+		modelName, action = param[:i], param[i+1:]
+	}
+	var stream bool
+	switch action {
+	case "generateContent":
+	case "streamGenerateContent":
+		stream = true
+	default:
+		c.JSON(http.StatusNotFound, gemini.ErrorOpenAI2Gemini(openai.ErrorWrapper(fmt.Errorf("unsupported method: %s", action), "invalid_request", http.StatusNotFound)))
+		return
+	}
+
+	var geminiRequest gemini.ChatRequest
+	if err := c.ShouldBindJSON(&geminiRequest); err != nil {
+		logger.Error("ShouldBindJSON err", xlog.Err(err))
+		c.JSON(http.StatusBadRequest, gemini.ErrorOpenAI2Gemini(openai.ErrorWrapper(err, "invalid_request", http.StatusBadRequest)))
+		return
+	}
+	textRequest, err := gemini.RequestGemini2OpenAI(&geminiRequest, modelName, stream)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gemini.ErrorOpenAI2Gemini(openai.ErrorWrapper(err, "invalid_request", http.StatusBadRequest)))
+		return
+	}
+
+	w := gemini.NewResponseWriter(c, meta, stream)
+	relayErr := relayText(c, meta, textRequest)
+	w.Finish(relayErr)
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/relay/billing"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+const (
+	defaultImageModel = "dall-e-2"
+	defaultImageSize  = "1024x1024"
+)
+
+func RelayImageHandler(c *gin.Context) {
+	meta := meta.GetByContext(c)
+	ctx := c.Request.Context()
+	logger := utils.Log(ctx, "RelayImageHandler")
+	var imageRequest *model.ImageRequest
+	err := common.UnmarshalBody(c, &imageRequest)
+	if err != nil || imageRequest == nil {
+		logger.Error("UnmarshalBody err", xlog.Err(err))
+		renderError(c, invalidRequestError("request body is invalid", ""))
+		return
+	}
+	if imageRequest.Prompt == "" {
+		renderError(c, invalidRequestError("prompt is required", "prompt"))
+		return
+	}
+	if imageRequest.Model == "" {
+		imageRequest.Model = defaultImageModel
+	}
+	if imageRequest.N == 0 {
+		imageRequest.N = 1
+	}
+	switch imageRequest.ResponseFormat {
+	case "", "url", "b64_json":
+	default:
+		renderError(c, invalidRequestError(fmt.Sprintf("invalid response_format: %s", imageRequest.ResponseFormat), "response_format"))
+		return
+	}
+	meta.FullMode = imageRequest.Model
+
+	if relayErr := setupMeta(meta, imageRequest.Model); relayErr != nil {
+		renderError(c, relayErr)
+		return
+	}
+	imageRequest.Model = meta.ActualModelName
+
+	modelInfo, _ := registry.Resolve(meta.FullMode)
+	defer withModelTimeout(c, modelInfo)()
+	if !apitype.Images[modelInfo.Type] || !modelInfo.Support(registry.CapabilityImage) {
+		renderError(c, capabilityError(modelInfo.Name, registry.CapabilityImage))
+		return
+	}
+
+	adaptorImpl := GetAdaptor(meta.APIType)
+	if adaptorImpl == nil {
+		renderError(c, openai.ErrorWrapper(fmt.Errorf("invalid api type: %s", meta.APIType), "invalid_api_type", http.StatusInternalServerError))
+		return
+	}
+
+	// 图片按张数预扣额度，成功后不再结算
+	size := imageRequest.Size
+	if size == "" {
+		size = defaultImageSize
+	}
+	quota, ok := billing.ImageCost(modelInfo, size, imageRequest.Quality, imageRequest.N)
+	if !ok {
+		renderError(c, invalidRequestError(fmt.Sprintf("unsupported size or quality: %s %s", size, imageRequest.Quality), "size"))
+		return
+	}
+	if relayErr := billing.PreConsume(meta, quota); relayErr != nil {
+		renderError(c, relayErr)
+		return
+	}
+
+	convertedRequest, err := adaptorImpl.ConvertImageRequest(imageRequest)
+	if err != nil {
+		billing.Refund(ctx, meta)
+		renderError(c, openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest))
+		return
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		billing.Refund(ctx, meta)
+		renderError(c, openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError))
+		return
+	}
+
+	resp, relayErr := doRequest(c, adaptorImpl, meta, modelInfo, jsonData)
+	if relayErr != nil {
+		billing.Refund(ctx, meta)
+		renderError(c, relayErr)
+		return
+	}
+	defer resp.Body.Close()
+
+	_, respErr := adaptorImpl.DoResponse(c, resp, meta)
+	if respErr != nil {
+		respErr = timeoutError(c, respErr)
+		logger.Error("respErr is not nil", xlog.Any("respErr", respErr))
+		billing.Refund(ctx, meta)
+		if !c.Writer.Written() {
+			renderError(c, respErr)
+		}
+		return
+	}
+
+	logger.Info("image generated", xlog.Int("n", imageRequest.N), xlog.Int64("quota", quota))
+}
+
+func invalidRequestError(message string, param string) *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+			Param:   param,
+		},
+		StatusCode: http.StatusBadRequest,
+	}
+}
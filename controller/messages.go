@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/anthropic"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+// RelayClaudeMessagesHandler 接收 Claude 格式的 /v1/messages 请求，转换成 OpenAI 格式后可以转发给任意上游，响应再转回 Claude 格式
+func RelayClaudeMessagesHandler(c *gin.Context) {
+	meta := meta.GetByContext(c)
+	// 转换后按对话请求转发
+	meta.Mode = relaymode.ChatCompletions
+	logger := utils.Log(c.Request.Context(), "RelayClaudeMessagesHandler")
+
+	var claudeRequest anthropic.Request
+	if err := c.ShouldBindJSON(&claudeRequest); err != nil {
+		logger.Error("ShouldBindJSON err", xlog.Err(err))
+		c.JSON(http.StatusBadRequest, anthropic.ErrorOpenAI2Claude(openai.ErrorWrapper(err, "invalid_request", http.StatusBadRequest)))
+		return
+	}
+
+	w := anthropic.NewResponseWriter(c, meta, claudeRequest.Stream)
+	relayErr := relayText(c, meta, anthropic.RequestClaude2OpenAI(&claudeRequest))
+	w.Finish(relayErr)
+}
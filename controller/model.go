@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common/ctxkey"
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/relay/channel"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+// 获取单个上游模型列表的超时时间
+const fetchUpstreamModelsTimeout = 10 * time.Second
+
+// https://platform.openai.com/docs/api-reference/models/object
+type OpenAIModel struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func newOpenAIModel(id string, modelInfo *registry.Model) OpenAIModel {
+	return OpenAIModel{
+		Id:      id,
+		Object:  "model",
+		Created: modelInfo.Created,
+		OwnedBy: modelInfo.OwnedBy,
+	}
+}
+
+// modelAvailable 配置了渠道时需要有能服务该模型的已启用渠道，被熔断暂时停用的渠道也算在内
+func modelAvailable(modelInfo *registry.Model) bool {
+	channels := channel.Channels()
+	if len(channels) == 0 {
+		return true
+	}
+	for _, ch := range channels {
+		if ch.IsEnabled() && ch.CanServe(modelInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListModels 列出当前令牌可以使用的模型，别名单独列出；管理员传 upstream=true 时合并各渠道上游的模型列表
+func ListModels(c *gin.Context) {
+	tokenModels := c.GetStringSlice(ctxkey.TokenModels)
+	models := make([]OpenAIModel, 0)
+	seen := make(map[string]bool)
+	for _, modelInfo := range registry.Models() {
+		if !tokenCanUse(tokenModels, modelInfo) || !modelAvailable(modelInfo) {
+			continue
+		}
+		for _, name := range append([]string{modelInfo.Name}, modelInfo.Aliases...) {
+			models = append(models, newOpenAIModel(name, modelInfo))
+			seen[name] = true
+		}
+	}
+
+	if c.Query("upstream") == "true" {
+		if !c.GetBool(ctxkey.IsAdmin) {
+			abortWithForbidden(c)
+			return
+		}
+		for _, upstreamModel := range fetchUpstreamModels(c.Request.Context()) {
+			if seen[upstreamModel.Id] {
+				continue
+			}
+			models = append(models, upstreamModel)
+			seen[upstreamModel.Id] = true
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   models,
+	})
+}
+
+func RetrieveModel(c *gin.Context) {
+	// 路由使用 *id 匹配带 / 的模型名
+	id := strings.TrimPrefix(c.Param("id"), "/")
+	modelInfo, ok := registry.Resolve(id)
+	if !ok || !tokenCanUse(c.GetStringSlice(ctxkey.TokenModels), modelInfo) || !modelAvailable(modelInfo) {
+		renderError(c, modelNotFoundError(id))
+		return
+	}
+	c.JSON(http.StatusOK, newOpenAIModel(id, modelInfo))
+}
+
+func abortWithForbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"error": gin.H{
+		"message": "Only administrators can list upstream models.",
+		"type":    "invalid_request_error",
+		"code":    "permission_denied",
+	}})
+}
+
+// fetchUpstreamModels 并发请求各个已启用渠道的模型列表，失败的渠道只记日志
+func fetchUpstreamModels(ctx context.Context) []OpenAIModel {
+	logger := utils.Log(ctx, "fetchUpstreamModels")
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		models []OpenAIModel
+	)
+	now := time.Now().Unix()
+	for _, ch := range channel.Channels() {
+		if !ch.IsEnabled() {
+			continue
+		}
+		wg.Add(1)
+		go func(ch *channel.Channel) {
+			defer wg.Done()
+			baseURL := ch.BaseURL
+			if baseURL == "" {
+				baseURL = apitype.DefaultBaseURL[ch.Type]
+			}
+			fetchCtx, cancel := context.WithTimeout(ctx, fetchUpstreamModelsTimeout)
+			defer cancel()
+
+			names, err := adaptor.FetchUpstreamModels(fetchCtx, ch.Type, baseURL, ch.NextKey(), ch.Headers)
+			if err != nil {
+				logger.Error("FetchUpstreamModels err", xlog.Err(err), xlog.Int64("channelId", int64(ch.Id)))
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, name := range names {
+				models = append(models, OpenAIModel{
+					Id:      name,
+					Object:  "model",
+					Created: now,
+					OwnedBy: apitype.OwnedBy[ch.Type],
+				})
+			}
+		}(ch)
+	}
+	wg.Wait()
+	return models
+}
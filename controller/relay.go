@@ -1,16 +1,30 @@
 package controller
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"io"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/xiaoxiongmao5/we-api/common"
 	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/relay/balancer"
+	"github.com/xiaoxiongmao5/we-api/relay/billing"
+	"github.com/xiaoxiongmao5/we-api/relay/channel"
 	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+	"github.com/xiaoxiongmao5/we-api/relay/timeout"
 	"github.com/xiaoxiongmao5/we-api/service/adaptor"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/anthropic"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/gemini"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/ollama"
 	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/whisper"
 	"github.com/xiaoxiongmao5/we-api/utils"
 	"github.com/xiaoxiongmao5/we-api/xlog"
 )
@@ -26,56 +40,255 @@ func RelayTextHander(c *gin.Context) {
 		c.JSON(400, gin.H{"message": "param invalid"})
 		return
 	}
-	meta.IsStream = textRequest.Stream
-	meta.FullMode = textRequest.Model
 
-	// 获取适配器
-	adaptorImpl := GetAdaptor(textRequest.Model)
-	if adaptorImpl == nil {
-		return
+	if relayErr := relayText(c, meta, textRequest); relayErr != nil {
+		// 流式响应可能已经写出了部分数据，此时无法再返回 json 错误
+		if !c.Writer.Written() {
+			renderError(c, relayErr)
+		}
+	}
+}
+
+// relayText 转发 OpenAI 格式的请求，响应以 OpenAI 格式写出；出错时不写响应，由调用方按各自的协议返回错误
+func relayText(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	logger := utils.Log(ctx, "relayText")
+	adaptorImpl, modelInfo, done, relayErr := prepareRelay(c, meta, textRequest)
+	defer done()
+	if relayErr != nil {
+		return relayErr
 	}
 
 	// get request body
 	requestBody, err := getRequestBody(c, meta, textRequest, adaptorImpl)
 	if err != nil {
-		c.JSON(410, gin.H{"message": err.Error()})
-		return
+		billing.Refund(ctx, meta)
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest)
 	}
 
-	// do request
-	resp, err := adaptor.DoRequest(c, adaptorImpl, meta, requestBody)
-	if err != nil {
-		logger.Error("DoRequest failed", xlog.Err(err))
-		c.JSON(411, gin.H{"message": err.Error()})
-		return
+	// do request，失败时按模型的重试策略换渠道重试
+	resp, relayErr := doRequest(c, adaptorImpl, meta, modelInfo, requestBody)
+	if relayErr != nil {
+		billing.Refund(ctx, meta)
+		return relayErr
 	}
+	// 适配器出错提前返回时也要关闭响应体，请求才会从渠道的负载统计中结束
+	defer resp.Body.Close()
 
 	// do response
 	usage, respErr := adaptorImpl.DoResponse(c, resp, meta)
 	if respErr != nil {
+		respErr = timeoutError(c, respErr)
 		logger.Error("respErr is not nil", xlog.Any("respErr", respErr))
-		return
+		// 流式响应中断时可能已经拿到了部分用量，按实际用量结算
+		if usage != nil {
+			billing.PostConsume(ctx, meta, usage)
+		} else {
+			billing.Refund(ctx, meta)
+		}
+		return respErr
 	}
 
 	logger.Info("usage", xlog.Any("usage", usage))
+	billing.PostConsume(ctx, meta, usage)
+	return nil
+}
+
+// prepareRelay 对话接口和 Responses 透传共用的转发前流程：解析模型、检查模型能力，再按预估用量预扣额度。
+// 返回的函数在请求结束时调用，出错时同样需要调用
+func prepareRelay(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest) (adaptor.Adaptor, *registry.Model, context.CancelFunc, *model.ErrorWithStatusCode) {
+	done := func() {}
+	meta.IsStream = textRequest.Stream
+	meta.FullMode = textRequest.Model
+
+	if relayErr := setupMeta(meta, textRequest.Model); relayErr != nil {
+		return nil, nil, done, relayErr
+	}
+	textRequest.Model = meta.ActualModelName
+
+	// 获取适配器
+	adaptorImpl := GetAdaptor(meta.APIType)
+	if adaptorImpl == nil {
+		return nil, nil, done, openai.ErrorWrapper(fmt.Errorf("invalid api type: %s", meta.APIType), "invalid_api_type", http.StatusInternalServerError)
+	}
+
+	modelInfo, _ := registry.Resolve(meta.FullMode)
+	done = withModelTimeout(c, modelInfo)
+	if relayErr := checkCapabilities(meta.Mode, modelInfo, textRequest); relayErr != nil {
+		return nil, nil, done, relayErr
+	}
+
+	// 按预估用量预扣额度
+	meta.PromptTokens = billing.EstimatePromptTokens(textRequest, meta.ActualModelName)
+	preConsumedQuota := billing.Cost(modelInfo, meta.PromptTokens, billing.EstimateCompletionTokens(textRequest))
+	if relayErr := billing.PreConsume(meta, preConsumedQuota); relayErr != nil {
+		return nil, nil, done, relayErr
+	}
+	return adaptorImpl, modelInfo, done, nil
+}
+
+func GetAdaptor(apiType string) adaptor.Adaptor {
+	switch apiType {
+	case apitype.OpenAI:
+		return &openai.Adaptor{}
+	case apitype.Anthropic:
+		return &anthropic.Adaptor{}
+	case apitype.Gemini:
+		return &gemini.Adaptor{}
+	case apitype.Ollama:
+		return &ollama.Adaptor{}
+	case apitype.Whisper:
+		return &whisper.Adaptor{}
+	}
+	return nil
+}
+
+// setupMeta 解析模型，把模型信息记录到 meta 中。渠道在检查和预扣额度之后、发出请求时才选择，见 doRequest
+func setupMeta(meta *meta.Meta, modelName string) *model.ErrorWithStatusCode {
+	// 通过模型注册表解析模型，未注册的模型直接返回 404
+	modelInfo, ok := registry.Resolve(modelName)
+	if !ok || !tokenCanUse(meta.TokenModels, modelInfo) {
+		return modelNotFoundError(modelName)
+	}
+	meta.APIType = modelInfo.Type
+	meta.ActualModelName = modelInfo.UpstreamModel
+	return nil
 }
 
-func GetAdaptor(model string) adaptor.Adaptor {
-	var svr adaptor.Adaptor
-	switch model {
-	// case "gpt-3.5-turbo", "gpt-4o":
-	// 	svr = &openai.Adaptor{}
-	// case "gemini-2.0-flash-exp":
-	// 	return ai.NewGeminiSvr(ctx)
-	// case "claude-3-5-sonnet-20241022":
-	// 	return ai.NewClaudeSvr(ctx)
+// selectChannel 选择渠道和 key 并写入 meta，重试时避开 failed 中已经失败的
+func selectChannel(meta *meta.Meta, modelInfo *registry.Model, failed *upstreams) *model.ErrorWithStatusCode {
+	ch, err := channel.Select(modelInfo, failed.channelIds...)
+	switch {
+	case err == nil:
+		// 渠道没有配置 key 时不带鉴权信息，例如本地部署的服务
+		useChannel(meta, modelInfo, ch, ch.PickKey(balancer.StrategyFor(modelInfo), failed.keys...))
+	case len(channel.Channels()) > 0:
+		// 配置了渠道但没有可用的，不再回退到模型配置
+		return openai.ErrorWrapper(err, "no_available_channel", http.StatusServiceUnavailable)
 	default:
-		svr = &openai.Adaptor{}
+		useChannel(meta, modelInfo, nil, "")
+	}
+	return nil
+}
+
+// peekChannel 与 selectChannel 相同，但不改变熔断器的状态，也不写入 meta；没有配置渠道时返回 nil
+func peekChannel(modelInfo *registry.Model, failed *upstreams) (*channel.Channel, string, error) {
+	ch, err := channel.Peek(modelInfo, failed.channelIds...)
+	switch {
+	case err == nil:
+		return ch, ch.PeekKey(balancer.StrategyFor(modelInfo), failed.keys...), nil
+	case len(channel.Channels()) > 0:
+		return nil, "", err
+	}
+	return nil, "", nil
+}
+
+// useChannel 把上游信息记录到 meta 中，ch 为 nil 时使用模型配置的上游地址
+func useChannel(meta *meta.Meta, modelInfo *registry.Model, ch *channel.Channel, key string) {
+	meta.BaseURL = modelInfo.BaseURL
+	meta.Timeouts = timeout.For(modelInfo.Timeouts, nil)
+	meta.ChannelId = 0
+	meta.APIKey = key
+	meta.Headers = nil
+	if ch != nil {
+		meta.ChannelId = ch.Id
+		meta.Timeouts = timeout.For(modelInfo.Timeouts, ch.Timeouts)
+		if ch.BaseURL != "" {
+			meta.BaseURL = ch.BaseURL
+		}
+		meta.Headers = ch.Headers
+	}
+	if meta.BaseURL == "" {
+		meta.BaseURL = apitype.DefaultBaseURL[meta.APIType]
+	}
+}
+
+// withModelTimeout 模型配置了超时时间时给请求的 context 加上期限，上游请求和读取响应都受它限制；返回的函数在请求结束时调用
+func withModelTimeout(c *gin.Context, modelInfo *registry.Model) context.CancelFunc {
+	if modelInfo == nil || modelInfo.Timeout <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(modelInfo.Timeout)*time.Second)
+	c.Request = c.Request.WithContext(ctx)
+	return cancel
+}
+
+// checkCapabilities 请求中用到的能力模型不支持时直接拒绝，不再转发给上游
+func checkCapabilities(mode string, modelInfo *registry.Model, textRequest *model.GeneralOpenAIRequest) *model.ErrorWithStatusCode {
+	if mode == relaymode.Embeddings {
+		if !apitype.Embeddings[modelInfo.Type] || !modelInfo.Support(registry.CapabilityEmbedding) {
+			return capabilityError(modelInfo.Name, registry.CapabilityEmbedding)
+		}
+		if len(textRequest.ParseInput()) == 0 && textRequest.InputTokens() == 0 {
+			return invalidRequestError("input is required", "input")
+		}
+		return nil
+	}
+	if mode == relaymode.ChatCompletions && !modelInfo.Support(registry.CapabilityChat) {
+		return capabilityError(modelInfo.Name, registry.CapabilityChat)
+	}
+	if (len(textRequest.Tools) > 0 || textRequest.ToolChoice != nil || textRequest.Functions != nil || textRequest.FunctionCall != nil) && !modelInfo.Support(registry.CapabilityTools) {
+		return capabilityError(modelInfo.Name, registry.CapabilityTools)
 	}
-	return svr
+
+	for _, message := range textRequest.Messages {
+		if message.HasImage() && !modelInfo.Support(registry.CapabilityVision) {
+			return capabilityError(modelInfo.Name, registry.CapabilityVision)
+		}
+		if message.HasAudio() && (!apitype.AudioInput[modelInfo.Type] || !modelInfo.Support(registry.CapabilityAudio)) {
+			return capabilityError(modelInfo.Name, "audio input")
+		}
+	}
+	if textRequest.HasAudioOutput() && (!apitype.AudioOutput[modelInfo.Type] || !modelInfo.Support(registry.CapabilityAudio)) {
+		return capabilityError(modelInfo.Name, "audio output")
+	}
+	return nil
+}
+
+func capabilityError(modelName string, capability string) *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: fmt.Sprintf("The model `%s` does not support %s.", modelName, capability),
+			Type:    "invalid_request_error",
+			Param:   "messages",
+			Code:    "unsupported_capability",
+		},
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+// tokenCanUse 令牌的 models 中可以写模型名或别名
+func tokenCanUse(tokenModels []string, modelInfo *registry.Model) bool {
+	if len(tokenModels) == 0 {
+		return true
+	}
+	for _, name := range append([]string{modelInfo.Name}, modelInfo.Aliases...) {
+		if slices.Contains(tokenModels, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func modelNotFoundError(modelName string) *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: fmt.Sprintf("The model `%s` does not exist or you do not have access to it.", modelName),
+			Type:    "invalid_request_error",
+			Param:   "model",
+			Code:    "model_not_found",
+		},
+		StatusCode: http.StatusNotFound,
+	}
+}
+
+// renderError 按 OpenAI 的错误格式返回
+func renderError(c *gin.Context, err *model.ErrorWithStatusCode) {
+	c.JSON(err.StatusCode, gin.H{"error": err.Error})
 }
 
-func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, adaptorImpl adaptor.Adaptor) (io.Reader, error) {
+// getRequestBody 返回转换后的完整请求体，重试时重复使用
+func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, adaptorImpl adaptor.Adaptor) ([]byte, error) {
 	ctx := c.Request.Context()
 	logger := utils.Log(ctx, "getRequestBody")
 
@@ -92,9 +305,8 @@ func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralO
 		return nil, err
 	}
 
-	logger.Info("", xlog.String("jsonData", string(jsonData)))
-
-	requestBody := bytes.NewReader(jsonData)
-	return requestBody, nil
+	// 请求中可能带有 base64 的图片和音频，只记录大小
+	logger.Info("converted request", xlog.String("model", textRequest.Model), xlog.Int("size", len(jsonData)))
 
+	return jsonData, nil
 }
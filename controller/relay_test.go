@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common/config"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/relay/channel"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+)
+
+// 检查在选择渠道之前完成，失败的请求不会占用停用渠道的探测名额，也不会因为没有可用渠道返回 503
+func TestPreCheckFailureKeepsChannelState(t *testing.T) {
+	if err := registry.Init([]config.Model{{Name: "text-model", Type: apitype.OpenAI}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := channel.Init([]config.Channel{{Id: 1, Type: apitype.OpenAI}}); err != nil {
+		t.Fatal(err)
+	}
+	ch := channel.Get(1)
+	ch.Report("", channel.FaultKeyFatal, "invalid key")
+	before, _ := ch.Status()
+	if before.State != channel.StateOpen {
+		t.Fatalf("state = %s, want %s", before.State, channel.StateOpen)
+	}
+
+	var textRequest model.GeneralOpenAIRequest
+	body := `{"model":"text-model","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`
+	if err := json.Unmarshal([]byte(body), &textRequest); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	relayErr := relayText(c, &meta.Meta{Mode: relaymode.ChatCompletions}, &textRequest)
+	if relayErr == nil || relayErr.StatusCode != http.StatusBadRequest || relayErr.Code != "unsupported_capability" {
+		t.Fatalf("relayErr = %+v, want 400 unsupported_capability", relayErr)
+	}
+
+	after, _ := ch.Status()
+	if after != before {
+		t.Errorf("status = %+v, want %+v", after, before)
+	}
+}
@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common/ctxkey"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/relay/billing"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+	"github.com/xiaoxiongmao5/we-api/store"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+// RelayResponsesHandler 处理 /v1/responses 请求。
+// 模型声明了 responses 能力且上游是 OpenAI 时直接透传，否则转换成对话请求转发给任意上游，响应再转换成 Responses 格式。
+// previous_response_id 由网关在本地保存的响应中展开，上游不需要保存对话
+func RelayResponsesHandler(c *gin.Context) {
+	meta := meta.GetByContext(c)
+	ctx := c.Request.Context()
+	logger := utils.Log(ctx, "RelayResponsesHandler")
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		renderError(c, openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest))
+		return
+	}
+	var request openai.ResponsesRequest
+	if err = json.Unmarshal(body, &request); err != nil {
+		logger.Error("json.Unmarshal err", xlog.Err(err))
+		renderError(c, invalidRequestError("request body is invalid", ""))
+		return
+	}
+	if request.Model == "" {
+		renderError(c, invalidRequestError("model is required", "model"))
+		return
+	}
+	input, err := request.InputItems()
+	if err != nil {
+		renderError(c, invalidRequestError(err.Error(), "input"))
+		return
+	}
+
+	var history []json.RawMessage
+	if request.PreviousResponseId != "" {
+		history, err = store.ResponseHistory(request.PreviousResponseId, meta.UserId)
+		if err != nil {
+			logger.Error("store.ResponseHistory err", xlog.Err(err), xlog.String("previousResponseId", request.PreviousResponseId))
+			renderError(c, previousResponseNotFoundError(request.PreviousResponseId))
+			return
+		}
+	}
+	items := append(history, input...)
+
+	// 只有部分内容无法转换时仍返回对话请求，透传时可以继续转发，转换转发时再报错
+	textRequest, convertErr := openai.ConvertResponsesRequest(&request, items)
+	if textRequest == nil {
+		if convertErr == nil {
+			convertErr = errors.New("request cannot be converted")
+		}
+		renderError(c, invalidRequestError(convertErr.Error(), ""))
+		return
+	}
+
+	var (
+		response *openai.ResponsesResponse
+		relayErr *model.ErrorWithStatusCode
+	)
+	if modelInfo, ok := registry.Resolve(request.Model); ok && apitype.Responses[modelInfo.Type] && modelInfo.Support(registry.CapabilityResponses) {
+		response, relayErr = relayResponses(c, meta, textRequest, body, items)
+		if relayErr != nil && !c.Writer.Written() {
+			renderError(c, relayErr)
+		}
+	} else {
+		if convertErr != nil {
+			renderError(c, invalidRequestError(convertErr.Error(), ""))
+			return
+		}
+		// 转换后按对话请求转发
+		meta.Mode = relaymode.ChatCompletions
+		w := openai.NewResponsesWriter(c, meta, &request)
+		relayErr = relayText(c, meta, textRequest)
+		w.Finish(relayErr)
+		response = w.Response()
+	}
+
+	if relayErr != nil || response == nil || (request.Store != nil && !*request.Store) {
+		return
+	}
+	if err = saveResponse(meta.UserId, &request, input, response); err != nil {
+		logger.Error("saveResponse err", xlog.Err(err), xlog.String("id", response.Id))
+	}
+}
+
+// relayResponses 把请求透传给上游的 /v1/responses，历史已经展开到 input 中
+func relayResponses(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, body []byte, items []json.RawMessage) (*openai.ResponsesResponse, *model.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+	logger := utils.Log(ctx, "relayResponses")
+	adaptorImpl, modelInfo, done, relayErr := prepareRelay(c, meta, textRequest)
+	defer done()
+	if relayErr != nil {
+		return nil, relayErr
+	}
+
+	// 保留调用方的其它参数，对话由网关保存，上游不需要再保存。
+	// 上游不保存时推理项只能通过加密内容回放，因此总是请求返回 encrypted_content，没有加密内容的推理项不再转发
+	var upstreamRequest map[string]any
+	if err := json.Unmarshal(body, &upstreamRequest); err != nil {
+		billing.Refund(ctx, meta)
+		return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest)
+	}
+	upstreamRequest["model"] = meta.ActualModelName
+	upstreamRequest["input"] = replayableItems(items)
+	upstreamRequest["store"] = false
+	upstreamRequest["include"] = includeEncryptedReasoning(upstreamRequest["include"])
+	delete(upstreamRequest, "previous_response_id")
+	jsonData, err := json.Marshal(upstreamRequest)
+	if err != nil {
+		billing.Refund(ctx, meta)
+		return nil, openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+
+	resp, relayErr := doRequest(c, adaptorImpl, meta, modelInfo, jsonData)
+	if relayErr != nil {
+		billing.Refund(ctx, meta)
+		return nil, relayErr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		billing.Refund(ctx, meta)
+		return nil, openai.ErrorHandler(resp)
+	}
+
+	var (
+		response *openai.ResponsesResponse
+		respErr  *model.ErrorWithStatusCode
+	)
+	if meta.IsStream {
+		respErr, response = openai.ResponsesStreamHandler(c, resp)
+	} else {
+		respErr, response = openai.ResponsesHandler(c, resp)
+	}
+	var usage *model.Usage
+	if response != nil {
+		usage = response.Usage.ToUsage()
+	}
+	if respErr != nil {
+		respErr = timeoutError(c, respErr)
+		logger.Error("respErr is not nil", xlog.Any("respErr", respErr))
+		if usage != nil {
+			billing.PostConsume(ctx, meta, usage)
+		} else {
+			billing.Refund(ctx, meta)
+		}
+		return nil, respErr
+	}
+
+	logger.Info("usage", xlog.Any("usage", usage))
+	billing.PostConsume(ctx, meta, usage)
+	if response != nil && response.Status == "failed" {
+		return nil, nil
+	}
+	return response, nil
+}
+
+// encryptedReasoning Responses API 返回推理项加密内容的 include 参数
+const encryptedReasoning = "reasoning.encrypted_content"
+
+// includeEncryptedReasoning 在调用方的 include 参数中加上推理项的加密内容
+func includeEncryptedReasoning(include any) []any {
+	values, _ := include.([]any)
+	if slices.Contains(values, any(encryptedReasoning)) {
+		return values
+	}
+	return append(values, encryptedReasoning)
+}
+
+// replayableItems 去掉没有加密内容的推理项，上游不保存对话时无法按 id 找到它们
+func replayableItems(items []json.RawMessage) []json.RawMessage {
+	result := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		var reasoning struct {
+			Type             string  `json:"type"`
+			EncryptedContent *string `json:"encrypted_content"`
+		}
+		if json.Unmarshal(item, &reasoning) == nil && reasoning.Type == "reasoning" && reasoning.EncryptedContent == nil {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+func saveResponse(userId int, request *openai.ResponsesRequest, input []json.RawMessage, response *openai.ResponsesResponse) error {
+	output := make([]json.RawMessage, 0, len(response.Output))
+	for _, item := range response.Output {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		output = append(output, data)
+	}
+	if request.PreviousResponseId != "" {
+		response.PreviousResponseId = request.PreviousResponseId
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return store.SaveResponse(&store.Response{
+		Id:                 response.Id,
+		UserId:             userId,
+		PreviousResponseId: request.PreviousResponseId,
+		Input:              input,
+		Output:             output,
+		Body:               body,
+	})
+}
+
+// GetResponse 查询保存的响应
+func GetResponse(c *gin.Context) {
+	response, err := store.GetResponse(c.Param("id"), c.GetInt(ctxkey.Id))
+	if err != nil {
+		renderError(c, responseNotFoundError(c.Param("id"), err))
+		return
+	}
+	c.Data(http.StatusOK, "application/json", response.Body)
+}
+
+// DeleteResponse 删除保存的响应，之后不能再作为 previous_response_id 使用
+func DeleteResponse(c *gin.Context) {
+	id := c.Param("id")
+	if err := store.DeleteResponse(id, c.GetInt(ctxkey.Id)); err != nil {
+		renderError(c, responseNotFoundError(id, err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"object":  "response.deleted",
+		"deleted": true,
+	})
+}
+
+func responseNotFoundError(id string, err error) *model.ErrorWithStatusCode {
+	if !errors.Is(err, store.ErrNotFound) {
+		return openai.ErrorWrapper(err, "get_response_failed", http.StatusInternalServerError)
+	}
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: fmt.Sprintf("Response with id '%s' not found.", id),
+			Type:    "invalid_request_error",
+			Param:   "id",
+		},
+		StatusCode: http.StatusNotFound,
+	}
+}
+
+func previousResponseNotFoundError(id string) *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: fmt.Sprintf("Previous response with id '%s' not found.", id),
+			Type:    "invalid_request_error",
+			Param:   "previous_response_id",
+			Code:    "previous_response_not_found",
+		},
+		StatusCode: http.StatusNotFound,
+	}
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common/ctxkey"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/balancer"
+	"github.com/xiaoxiongmao5/we-api/relay/channel"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/retry"
+	"github.com/xiaoxiongmao5/we-api/relay/timeout"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+// upstreams 记录本次请求已经失败过的渠道和 key，重试时优先换一个
+type upstreams struct {
+	channelIds []int
+	keys       []string
+}
+
+func (u *upstreams) add(meta *meta.Meta) {
+	if meta.ChannelId != 0 {
+		u.channelIds = append(u.channelIds, meta.ChannelId)
+	}
+	if meta.APIKey != "" {
+		u.keys = append(u.keys, meta.APIKey)
+	}
+}
+
+// doRequest 发送请求，网络错误、429、5xx 和 key 不可用时按模型的重试策略换一个渠道或 key 重试。
+// 请求体已经完整缓存，每次重试重新发送；重试只发生在响应写出之前，因此流式请求也不会给调用方重复输出。
+// 渠道在发出请求前才选择，之前的检查失败时不会占用停用渠道的探测名额。
+// 每次请求的结果都会反馈给渠道的熔断器；最后一次失败的响应原样返回，由适配器按上游的错误格式解析
+func doRequest(c *gin.Context, adaptorImpl adaptor.Adaptor, meta *meta.Meta, modelInfo *registry.Model, body []byte) (*http.Response, *model.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+	logger := utils.Log(ctx, "doRequest")
+	policy := retry.For(modelInfo)
+	failed := &upstreams{}
+	if relayErr := selectChannel(meta, modelInfo, failed); relayErr != nil {
+		return nil, relayErr
+	}
+
+	// 首 token 延迟从收到请求开始计算，重试时从本次请求开始计算
+	start := meta.StartTime
+	for attempt := 1; ; attempt++ {
+		tracker := startTracker(meta, start)
+		resp, err := adaptor.DoRequest(c, adaptorImpl, meta, bytes.NewReader(body))
+		if err != nil && ctx.Err() != nil {
+			// 调用方断开连接或者超时，不是渠道的问题，也不再重试；不反馈结果，释放占用的探测名额
+			tracker.Done()
+			if ch := channel.Get(meta.ChannelId); ch != nil {
+				ch.Release(meta.APIKey)
+			}
+			return lastResult(nil, err)
+		}
+		fault, reason := reportResult(meta, resp, err)
+		if err == nil && !retry.Retryable(resp.StatusCode) && fault != channel.FaultKey && fault != channel.FaultKeyFatal {
+			if resp.StatusCode == http.StatusOK {
+				// 响应体关闭时请求才结束
+				resp.Body = tracker.Wrap(watchBody(c, meta, resp.Body), meta.IsStream)
+			} else {
+				tracker.Done()
+			}
+			return resp, nil
+		}
+		tracker.Done()
+		if err == nil {
+			err = fmt.Errorf("bad response status code %d: %s", resp.StatusCode, reason)
+		}
+		logger.Error("DoRequest failed", xlog.Err(err),
+			xlog.Int64("attempt", int64(attempt)),
+			xlog.Int64("channelId", int64(meta.ChannelId)))
+
+		if attempt >= policy.MaxAttempts {
+			return lastResult(resp, err)
+		}
+		// 先选出下次请求的渠道和 key 但不占用，Retry-After 只对同一个渠道和 key 有意义
+		failed.add(meta)
+		ch, key, peekErr := peekChannel(modelInfo, failed)
+		if peekErr != nil {
+			// 没有其它可用的渠道，返回最后一次的错误
+			return lastResult(resp, err)
+		}
+		delay, ok := policy.Delay(attempt, resp, key == meta.APIKey && (ch == nil || ch.Id == meta.ChannelId))
+		if !ok || retry.Wait(ctx, delay) != nil {
+			return lastResult(resp, err)
+		}
+		// 确定重试后再占用选中的渠道和 key；等待期间它们被停用或者探测名额被其它请求占用时重新选择
+		if ch == nil || ch.Acquire(key) {
+			useChannel(meta, modelInfo, ch, key)
+		} else if relayErr := selectChannel(meta, modelInfo, failed); relayErr != nil {
+			return lastResult(resp, err)
+		}
+		start = time.Now()
+	}
+}
+
+// reportResult 把请求结果反馈给渠道的熔断器。出错的响应体会被读出用于判断原因，再放回 resp.Body
+func reportResult(meta *meta.Meta, resp *http.Response, err error) (channel.Fault, string) {
+	var (
+		statusCode int
+		body       []byte
+	)
+	if err == nil {
+		statusCode = resp.StatusCode
+		if statusCode >= http.StatusBadRequest {
+			body, _ = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+		}
+	}
+	fault, reason := channel.Classify(statusCode, body)
+	var timeoutErr *timeout.Error
+	if errors.As(err, &timeoutErr) {
+		reason = timeoutErr.Kind + " timeout"
+	}
+	if ch := channel.Get(meta.ChannelId); ch != nil {
+		ch.Report(meta.APIKey, fault, reason)
+	}
+	return fault, reason
+}
+
+// startTracker 把请求计入渠道和 key 的负载统计，没有配置渠道时不统计
+func startTracker(meta *meta.Meta, start time.Time) *balancer.Tracker {
+	ch := channel.Get(meta.ChannelId)
+	if ch == nil {
+		return balancer.Start(start)
+	}
+	if keyStats := ch.KeyStats(meta.APIKey); keyStats != nil {
+		return balancer.Start(start, ch.Stats(), keyStats)
+	}
+	return balancer.Start(start, ch.Stats())
+}
+
+func lastResult(resp *http.Response, err error) (*http.Response, *model.ErrorWithStatusCode) {
+	if resp != nil {
+		return resp, nil
+	}
+	return nil, requestError(err)
+}
+
+// requestError 没有收到上游的响应，超时返回 504，各阶段的超时有不同的错误码
+func requestError(err error) *model.ErrorWithStatusCode {
+	var timeoutErr *timeout.Error
+	switch {
+	case errors.As(err, &timeoutErr):
+		return openai.ErrorWrapper(err, "upstream_"+timeoutErr.Kind+"_timeout", http.StatusGatewayTimeout)
+	case errors.Is(err, context.DeadlineExceeded):
+		return openai.ErrorWrapper(err, "upstream_timeout", http.StatusGatewayTimeout)
+	}
+	return openai.ErrorWrapper(err, "do_request_failed", http.StatusBadGateway)
+}
+
+// timeoutError 读取响应时超时，按超时返回
+func timeoutError(c *gin.Context, respErr *model.ErrorWithStatusCode) *model.ErrorWithStatusCode {
+	if err, ok := c.Get(ctxkey.UpstreamTimeout); ok {
+		return requestError(err.(error))
+	}
+	if err := c.Request.Context().Err(); errors.Is(err, context.DeadlineExceeded) {
+		return requestError(err)
+	}
+	return respErr
+}
+
+// watchBody 读取响应时超时说明渠道有问题，此时已经无法重试，反馈给熔断器并记录下来，出错时按超时返回
+func watchBody(c *gin.Context, meta *meta.Meta, body io.ReadCloser) io.ReadCloser {
+	return &watchedBody{ReadCloser: body, c: c, meta: meta}
+}
+
+type watchedBody struct {
+	io.ReadCloser
+	c        *gin.Context
+	meta     *meta.Meta
+	reported bool
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var timeoutErr *timeout.Error
+	if !b.reported && errors.As(err, &timeoutErr) {
+		b.reported = true
+		b.c.Set(ctxkey.UpstreamTimeout, err)
+		if ch := channel.Get(b.meta.ChannelId); ch != nil {
+			ch.Report(b.meta.APIKey, channel.FaultChannel, timeoutErr.Kind+" timeout")
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common/ctxkey"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/store"
+)
+
+type createTokenReq struct {
+	UserId         int      `json:"user_id"` //为空时签发给当前用户
+	Name           string   `json:"name"`
+	ExpiredAt      int64    `json:"expired_at"` //为空时永不过期
+	RemainQuota    int64    `json:"remain_quota"`
+	UnlimitedQuota bool     `json:"unlimited_quota"`
+	Models         []string `json:"models"` //可使用的模型，为空时不限制
+}
+
+type createUserReq struct {
+	Username       string `json:"username" binding:"required"`
+	Role           int    `json:"role"`
+	Quota          int64  `json:"quota"`
+	UnlimitedQuota bool   `json:"unlimited_quota"`
+}
+
+type increaseQuotaReq struct {
+	Quota int64 `json:"quota" binding:"required"` //为负数时扣减
+}
+
+func badRequest(c *gin.Context, message string) {
+	renderError(c, &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+		},
+		StatusCode: http.StatusBadRequest,
+	})
+}
+
+func notFound(c *gin.Context, message string) {
+	renderError(c, &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+		},
+		StatusCode: http.StatusNotFound,
+	})
+}
+
+func internalError(c *gin.Context, err error) {
+	renderError(c, &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: err.Error(),
+			Type:    "we_api_error",
+		},
+		StatusCode: http.StatusInternalServerError,
+	})
+}
+
+func CreateToken(c *gin.Context) {
+	var req createTokenReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	if req.UserId == 0 {
+		req.UserId = c.GetInt(ctxkey.Id)
+	}
+	if req.ExpiredAt == 0 {
+		req.ExpiredAt = -1
+	}
+	if _, err := store.GetUserById(req.UserId); err != nil {
+		badRequest(c, "user not found")
+		return
+	}
+	// models 中可以写模型名或别名，写错的名字永远匹配不到，直接拒绝
+	for _, name := range req.Models {
+		if _, ok := registry.Resolve(name); !ok {
+			badRequest(c, fmt.Sprintf("model %s does not exist", name))
+			return
+		}
+	}
+
+	token, err := store.CreateToken(req.UserId, req.Name, req.ExpiredAt, req.RemainQuota, req.UnlimitedQuota, req.Models)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, token)
+}
+
+func ListTokens(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	c.JSON(http.StatusOK, gin.H{"data": store.ListTokens(userId)})
+}
+
+func DeleteToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, "invalid token id")
+		return
+	}
+	err = store.DeleteToken(id)
+	if errors.Is(err, store.ErrNotFound) {
+		notFound(c, fmt.Sprintf("token %d not found", id))
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+func CreateUser(c *gin.Context) {
+	var req createUserReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	if req.Role == 0 {
+		req.Role = store.RoleCommonUser
+	}
+
+	user, err := store.CreateUser(req.Username, req.Role, req.Quota, req.UnlimitedQuota)
+	if errors.Is(err, store.ErrUsernameExists) {
+		badRequest(c, err.Error())
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func ListUsers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": store.ListUsers()})
+}
+
+func IncreaseUserQuota(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, "invalid user id")
+		return
+	}
+	var req increaseQuotaReq
+	if err = c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	user, err := store.IncreaseUserQuota(id, req.Quota)
+	if errors.Is(err, store.ErrNotFound) {
+		notFound(c, fmt.Sprintf("user %d not found", id))
+		return
+	}
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
@@ -1,102 +1,29 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/xiaoxiongmao5/we-api/service/ai"
+	"github.com/xiaoxiongmao5/we-api/common/config"
+	"github.com/xiaoxiongmao5/we-api/common/media"
+	"github.com/xiaoxiongmao5/we-api/controller"
+	"github.com/xiaoxiongmao5/we-api/middleware"
+	"github.com/xiaoxiongmao5/we-api/relay/balancer"
+	"github.com/xiaoxiongmao5/we-api/relay/billing"
+	"github.com/xiaoxiongmao5/we-api/relay/channel"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/retry"
+	"github.com/xiaoxiongmao5/we-api/relay/timeout"
+	"github.com/xiaoxiongmao5/we-api/relay/tokenizer"
+	"github.com/xiaoxiongmao5/we-api/store"
 	"github.com/xiaoxiongmao5/we-api/xlog"
 )
 
-func GetAiSvr(ctx context.Context, model string) ai.DoCompletions {
-	switch model {
-	case "gpt-3.5-turbo", "gpt-4o", "":
-		return ai.NewOpenAiSvr(ctx)
-	case "gemini-2.0-flash-exp":
-		return ai.NewGeminiSvr(ctx)
-	case "claude-3-5-sonnet-20241022":
-		return ai.NewClaudeSvr(ctx)
-	default:
-		return ai.NewOpenAiSvr(ctx)
-	}
-}
-
-func completions(c *gin.Context) {
-	var req ai.OpenAiReq
-	err := c.ShouldBind(&req)
-	if err != nil {
-		jsonRender(c, 400, gin.H{"message": err.Error()})
-		return
-	}
-
-	svr := GetAiSvr(c.Request.Context(), req.Model)
-	authorization := c.Request.Header.Get("Authorization")
-	req.AuthHeader = authorization
-	if req.Stream {
-		resChan := make(chan *ai.OpenAiRes[ai.OpenAiChoiceStream])
-		errChan := make(chan error)
-		go func() {
-			svr.DoStream(req, resChan, errChan)
-		}()
-		streamRender(c, resChan, errChan)
-		return
-	}
-
-	// 非流式
-	if res, err := svr.Do(req); err != nil {
-		jsonRender(c, 500, gin.H{"message": err.Error()})
-	} else {
-		jsonRender(c, http.StatusOK, res)
-	}
-}
-
-func jsonRender(c *gin.Context, stateCode int, data interface{}) {
-	c.JSON(stateCode, data)
-}
-func streamRender(c *gin.Context, resChan chan *ai.OpenAiRes[ai.OpenAiChoiceStream], errChan chan error) {
-	// 设置响应头部，关键是 Content-Type: text/event-stream
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive") // 可选，通常默认 keep-alive
-	// 获取 ResponseWriter
-	writer := c.Writer
-
-	for {
-		select {
-		case res, ok := <-resChan:
-			if !ok {
-				fmt.Fprintf(writer, "[DONE]\n\n")
-				writer.(http.Flusher).Flush()
-				return
-			}
-
-			line, _ := json.Marshal(res)
-			// SSE 格式: data: your_data\n\n
-			fmt.Fprintf(writer, "data: %s\n\n", line)
-
-			// 强制刷新缓冲区，确保数据立即发送到客户端
-			writer.(http.Flusher).Flush()
-
-			// 检查客户端是否断开连接，如果断开则退出循环
-			if c.Request.Context().Err() != nil {
-				fmt.Println("Client disconnected")
-				return
-			}
-		case err := <-errChan:
-			if err != nil {
-				fmt.Fprintf(writer, "data: error: %s\n\n", err.Error())
-				writer.(http.Flusher).Flush()
-				return
-			}
-		}
-	}
-}
-
 func streamHandler(c *gin.Context) {
 	// 设置响应头部，关键是 Content-Type: text/event-stream
 	c.Header("Content-Type", "text/event-stream")
@@ -142,9 +69,95 @@ func main() {
 		os.Exit(-1)
 	}
 
-	r := gin.Default()
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		fmt.Printf("config.Load with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	if err = registry.Init(cfg.Models); err != nil {
+		fmt.Printf("registry.Init with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	if err = channel.Init(cfg.Channels); err != nil {
+		fmt.Printf("channel.Init with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	if err = billing.Init(cfg.Quota); err != nil {
+		fmt.Printf("billing.Init with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	if err = retry.Init(cfg.Retry); err != nil {
+		fmt.Printf("retry.Init with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	if err = balancer.Init(cfg.Balancer); err != nil {
+		fmt.Printf("balancer.Init with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	if err = timeout.Init(cfg.Timeouts); err != nil {
+		fmt.Printf("timeout.Init with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	if err = tokenizer.Init(); err != nil {
+		fmt.Printf("tokenizer.Init with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	media.Init(cfg.Image)
+
+	if err = store.Open(cfg.DatabasePath()); err != nil {
+		fmt.Printf("store.Open with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	// 额度的变化定时写回，退出前写回还没有保存的部分
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		if err := store.Flush(); err != nil {
+			fmt.Printf("store.Flush with error(%s)\n", err)
+		}
+		os.Exit(0)
+	}()
+	rootToken, err := store.InitRootUser()
+	if err != nil {
+		fmt.Printf("store.InitRootUser with error(%s)\n", err)
+		os.Exit(-1)
+	}
+	if rootToken != nil {
+		fmt.Printf("root token created, please keep it safe: %s\n", rootToken.Key)
+	}
 
-	r.POST("/v1/chat/completions", completions)
+	// key 查询参数在记录访问日志之前移除
+	r := gin.New()
+	r.Use(middleware.HideQueryKey(), gin.Logger(), gin.Recovery())
+
+	v1 := r.Group("/v1", middleware.TokenAuth())
+	v1.GET("/models", controller.ListModels)
+	v1.GET("/models/*id", controller.RetrieveModel)
+	v1.POST("/chat/completions", controller.RelayTextHander)
+	v1.POST("/completions", controller.RelayCompletionsHandler)
+	v1.POST("/messages", controller.RelayClaudeMessagesHandler)
+	v1.POST("/responses", controller.RelayResponsesHandler)
+	v1.GET("/responses/:id", controller.GetResponse)
+	v1.DELETE("/responses/:id", controller.DeleteResponse)
+	v1.POST("/embeddings", controller.RelayTextHander)
+	v1.POST("/images/generations", controller.RelayImageHandler)
+	v1.POST("/audio/speech", controller.RelayAudioHandler)
+	v1.POST("/audio/transcriptions", controller.RelayAudioHandler)
+	v1.POST("/audio/translations", controller.RelayAudioHandler)
+
+	// Gemini 格式的接口，路径参数形如 gemini-2.0-flash:generateContent
+	v1beta := r.Group("/v1beta", middleware.GeminiTokenAuth())
+	v1beta.POST("/models/:model", controller.RelayGeminiHandler)
+
+	api := r.Group("/api", middleware.TokenAuth(), middleware.AdminAuth())
+	api.GET("/user", controller.ListUsers)
+	api.POST("/user", controller.CreateUser)
+	api.POST("/user/:id/quota", controller.IncreaseUserQuota)
+	api.GET("/token", controller.ListTokens)
+	api.POST("/token", controller.CreateToken)
+	api.DELETE("/token/:id", controller.DeleteToken)
+	api.GET("/channel", controller.ListChannels)
 
 	r.Static("/static", "./static")
 
@@ -1,24 +1,41 @@
 package meta
 
 import (
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common/ctxkey"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+	"github.com/xiaoxiongmao5/we-api/relay/timeout"
 )
 
 type Meta struct {
-	Mode           string
-	FullMode       string
-	APIKey         string
-	IsStream       bool
-	RequestURLPath string
-	StartTime      time.Time
+	UserId           int
+	TokenId          int
+	Mode             string //接口类型，见 relay/relaymode
+	FullMode         string
+	ActualModelName  string //上游实际的模型名
+	APIType          string //服务商类型，见 relay/apitype
+	ChannelId        int    //本次请求选中的渠道，0 表示未配置渠道
+	BaseURL          string //上游地址
+	APIKey           string
+	Headers          map[string]string //渠道配置的额外请求头
+	Timeouts         timeout.Timeouts  //请求上游各阶段的超时时间
+	TokenModels      []string          //令牌可使用的模型，为空时不限制
+	PromptTokens     int               //预估的提示词 token 数
+	PreConsumedQuota int64             //预扣的额度
+	IsStream         bool
+	RequestURLPath   string
+	StartTime        time.Time
 }
 
 func GetByContext(c *gin.Context) *Meta {
+	// 调用方的令牌只在网关内校验，上游的 key 来自渠道
 	meta := Meta{
-		APIKey:         strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
+		UserId:         c.GetInt(ctxkey.Id),
+		TokenId:        c.GetInt(ctxkey.TokenId),
+		Mode:           relaymode.GetByPath(c.Request.URL.Path),
+		TokenModels:    c.GetStringSlice(ctxkey.TokenModels),
 		RequestURLPath: c.Request.URL.String(),
 		StartTime:      time.Now(),
 	}
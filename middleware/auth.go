@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common/ctxkey"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/store"
+)
+
+func abortWithError(c *gin.Context, statusCode int, message string, code string) {
+	c.AbortWithStatusJSON(statusCode, gin.H{
+		"error": model.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+// getKey 从请求头中取出令牌，兼容 Claude 客户端使用的 x-api-key 请求头和 Gemini 客户端使用的 x-goog-api-key 请求头。
+// allowQueryKey 为 true 时还接受 Gemini 客户端使用的 key 查询参数
+func getKey(c *gin.Context, allowQueryKey bool) string {
+	if key := strings.TrimSpace(strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")); key != "" {
+		return key
+	}
+	for _, header := range []string{"x-api-key", "x-goog-api-key"} {
+		if key := strings.TrimSpace(c.Request.Header.Get(header)); key != "" {
+			return key
+		}
+	}
+	if allowQueryKey {
+		return strings.TrimSpace(c.GetString(ctxkey.QueryKey))
+	}
+	return ""
+}
+
+// HideQueryKey 把 key 查询参数从 URL 中移到 gin.Context，避免令牌出现在访问日志中，需要在 gin.Logger 之前使用
+func HideQueryKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		if query.Has("key") {
+			c.Set(ctxkey.QueryKey, query.Get("key"))
+			query.Del("key")
+			c.Request.URL.RawQuery = query.Encode()
+		}
+		c.Next()
+	}
+}
+
+// TokenAuth 校验网关签发的令牌，并把用户和令牌信息保存到 gin.Context
+func TokenAuth() gin.HandlerFunc {
+	return tokenAuth(false)
+}
+
+// GeminiTokenAuth 与 TokenAuth 相同，另外接受 Gemini 客户端使用的 key 查询参数
+func GeminiTokenAuth() gin.HandlerFunc {
+	return tokenAuth(true)
+}
+
+func tokenAuth(allowQueryKey bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := getKey(c, allowQueryKey)
+		if key == "" {
+			abortWithError(c, http.StatusUnauthorized, "You didn't provide an API key.", "missing_api_key")
+			return
+		}
+
+		token, err := store.ValidateToken(key)
+		if err != nil {
+			if errors.Is(err, store.ErrTokenInvalid) {
+				abortWithError(c, http.StatusUnauthorized, "Incorrect API key provided.", "invalid_api_key")
+			} else {
+				abortWithError(c, http.StatusUnauthorized, err.Error(), "invalid_api_key")
+			}
+			return
+		}
+
+		user, err := store.GetUserById(token.UserId)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err.Error(), "invalid_api_key")
+			return
+		}
+
+		c.Set(ctxkey.Id, token.UserId)
+		c.Set(ctxkey.TokenId, token.Id)
+		c.Set(ctxkey.TokenName, token.Name)
+		c.Set(ctxkey.IsAdmin, user.IsAdmin())
+		c.Set(ctxkey.TokenModels, token.Models)
+		c.Next()
+	}
+}
+
+// AdminAuth 需要在 TokenAuth 之后使用
+func AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool(ctxkey.IsAdmin) {
+			abortWithError(c, http.StatusForbidden, "This operation requires an admin token.", "permission_denied")
+			return
+		}
+		c.Next()
+	}
+}
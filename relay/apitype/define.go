@@ -0,0 +1,57 @@
+package apitype
+
+// 上游服务商类型，对应不同的适配器
+const (
+	OpenAI    = "openai"
+	Anthropic = "anthropic"
+	Gemini    = "gemini"
+	Ollama    = "ollama"  //本地部署的 Ollama 服务
+	Whisper   = "whisper" //whisper.cpp 等自部署的语音转写服务
+)
+
+// 未配置 base_url 时使用的官方地址
+var DefaultBaseURL = map[string]string{
+	OpenAI:    "https://api.openai.com",
+	Anthropic: "https://api.anthropic.com",
+	Gemini:    "https://generativelanguage.googleapis.com",
+	Ollama:    "http://localhost:11434",
+	Whisper:   "http://localhost:8080",
+}
+
+// /v1/models 中模型默认的 owned_by
+var OwnedBy = map[string]string{
+	OpenAI:    "openai",
+	Anthropic: "anthropic",
+	Gemini:    "google",
+	Ollama:    "ollama",
+	Whisper:   "whisper.cpp",
+}
+
+// 服务商协议本身是否支持音频输入和音频输出，Claude 不支持音频
+var (
+	AudioInput  = map[string]bool{OpenAI: true, Gemini: true}
+	AudioOutput = map[string]bool{OpenAI: true}
+)
+
+// 支持向量接口的服务商
+var Embeddings = map[string]bool{OpenAI: true, Gemini: true, Ollama: true}
+
+// 支持图片生成接口的服务商，Gemini 使用 Imagen 模型
+var Images = map[string]bool{OpenAI: true, Gemini: true}
+
+// 支持语音合成和语音转写接口的服务商
+var (
+	Speech        = map[string]bool{OpenAI: true}
+	Transcription = map[string]bool{OpenAI: true, Whisper: true}
+)
+
+// 可以透传 /v1/responses 的服务商，其它服务商转换成对话接口
+var Responses = map[string]bool{OpenAI: true}
+
+// 可以透传 /v1/completions 的服务商，其它服务商把 prompt 转换成对话
+var Completions = map[string]bool{OpenAI: true, Ollama: true}
+
+func IsValid(apiType string) bool {
+	_, ok := DefaultBaseURL[apiType]
+	return ok
+}
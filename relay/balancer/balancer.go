@@ -0,0 +1,268 @@
+package balancer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaoxiongmao5/we-api/common/config"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/sse"
+)
+
+// 同一优先级内的选择策略
+const (
+	StrategyWeighted      = "weighted"       //按权重随机，默认
+	StrategyLeastInFlight = "least_inflight" //进行中的请求最少
+	StrategyLatency       = "latency"        //首 token 延迟的 EWMA 最低
+)
+
+const (
+	// EWMA 的平滑系数，越大越偏向最近的请求
+	latencyAlpha = 0.3
+	// 按延迟选择时有一定概率随机选择，让延迟较高的渠道也能更新统计
+	latencyExploreRate = 0.1
+)
+
+var (
+	mu sync.RWMutex
+	// 默认策略
+	defaultStrategy = StrategyWeighted
+	// 模型名 -> 所在分组的策略
+	groupStrategies map[string]string
+)
+
+func Init(cfg config.Balancer) error {
+	strategy := cfg.Strategy
+	if strategy == "" {
+		strategy = StrategyWeighted
+	}
+	if !isValid(strategy) {
+		return fmt.Errorf("unknown balancer strategy %q", strategy)
+	}
+
+	strategies := make(map[string]string)
+	for _, group := range cfg.Groups {
+		if !isValid(group.Strategy) {
+			return fmt.Errorf("unknown balancer strategy %q", group.Strategy)
+		}
+		for _, name := range group.Models {
+			if _, ok := strategies[name]; ok {
+				return fmt.Errorf("model %s is in multiple balancer groups", name)
+			}
+			strategies[name] = group.Strategy
+		}
+	}
+
+	mu.Lock()
+	defaultStrategy = strategy
+	groupStrategies = strategies
+	mu.Unlock()
+	return nil
+}
+
+func isValid(strategy string) bool {
+	switch strategy {
+	case StrategyWeighted, StrategyLeastInFlight, StrategyLatency:
+		return true
+	}
+	return false
+}
+
+// StrategyFor 返回模型所在分组的策略，分组中可以写模型名或别名
+func StrategyFor(m *registry.Model) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, name := range append([]string{m.Name}, m.Aliases...) {
+		if strategy, ok := groupStrategies[name]; ok {
+			return strategy
+		}
+	}
+	return defaultStrategy
+}
+
+// Stats 渠道或 key 的实时统计
+type Stats struct {
+	inFlight atomic.Int64
+	mu       sync.Mutex
+	latency  float64 //首 token 延迟的 EWMA，单位毫秒
+	samples  int
+}
+
+func (s *Stats) InFlight() int64 {
+	return s.inFlight.Load()
+}
+
+// Latency 首 token 延迟的 EWMA，没有数据时返回 false
+func (s *Stats) Latency() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.latency * float64(time.Millisecond)), s.samples > 0
+}
+
+func (s *Stats) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.samples == 0 {
+		s.latency = ms
+	} else {
+		s.latency = latencyAlpha*ms + (1-latencyAlpha)*s.latency
+	}
+	s.samples++
+}
+
+// Candidate 参与选择的渠道或 key
+type Candidate struct {
+	Priority int //数值大的优先
+	Weight   int //小于等于 0 时按 1 计算
+	Stats    *Stats
+}
+
+// Pick 返回选中的下标。只在优先级最高的候选中选择，调用方把不可用的候选去掉后再次调用即可回退到下一优先级
+func Pick(strategy string, candidates []Candidate) int {
+	if len(candidates) == 0 {
+		return -1
+	}
+	top := candidates[0].Priority
+	for _, candidate := range candidates {
+		top = max(top, candidate.Priority)
+	}
+	var tier []int
+	for i, candidate := range candidates {
+		if candidate.Priority == top {
+			tier = append(tier, i)
+		}
+	}
+
+	switch strategy {
+	case StrategyLeastInFlight:
+		return pickMin(tier, func(i int) float64 { return float64(candidates[i].Stats.InFlight()) })
+	case StrategyLatency:
+		// 还没有数据的候选优先，尽快得到统计
+		var unknown []int
+		for _, i := range tier {
+			if _, ok := candidates[i].Stats.Latency(); !ok {
+				unknown = append(unknown, i)
+			}
+		}
+		if len(unknown) > 0 {
+			return unknown[rand.Intn(len(unknown))]
+		}
+		if rand.Float64() < latencyExploreRate {
+			return tier[rand.Intn(len(tier))]
+		}
+		return pickMin(tier, func(i int) float64 {
+			latency, _ := candidates[i].Stats.Latency()
+			return float64(latency)
+		})
+	}
+
+	total := 0
+	for _, i := range tier {
+		total += weight(candidates[i])
+	}
+	r := rand.Intn(total)
+	for _, i := range tier {
+		if r -= weight(candidates[i]); r < 0 {
+			return i
+		}
+	}
+	return tier[len(tier)-1]
+}
+
+func weight(candidate Candidate) int {
+	return max(candidate.Weight, 1)
+}
+
+// pickMin 返回 value 最小的下标，相同时随机选择
+func pickMin(tier []int, value func(int) float64) int {
+	var best []int
+	var bestValue float64
+	for _, i := range tier {
+		v := value(i)
+		switch {
+		case len(best) == 0 || v < bestValue:
+			best = []int{i}
+			bestValue = v
+		case v == bestValue:
+			best = append(best, i)
+		}
+	}
+	return best[rand.Intn(len(best))]
+}
+
+// Tracker 记录一次上游请求，请求期间计入进行中的请求数
+type Tracker struct {
+	stats []*Stats
+	start time.Time
+	once  sync.Once
+}
+
+// Start 开始一次请求，start 为计算首 token 延迟的起点
+func Start(start time.Time, stats ...*Stats) *Tracker {
+	for _, s := range stats {
+		s.inFlight.Add(1)
+	}
+	return &Tracker{stats: stats, start: start}
+}
+
+// Done 请求结束，可以重复调用
+func (t *Tracker) Done() {
+	t.once.Do(func() {
+		for _, s := range t.stats {
+			s.inFlight.Add(-1)
+		}
+	})
+}
+
+// Wrap 包装响应体，关闭时结束请求。流式响应读到第一个带有生成内容的事件时记录首 token 延迟；
+// 非流式响应的第一个字节要等全部生成完才返回，不计入延迟统计
+func (t *Tracker) Wrap(body io.ReadCloser, stream bool) io.ReadCloser {
+	return &trackedBody{ReadCloser: body, tracker: t, observed: !stream}
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	tracker  *Tracker
+	observed bool
+	line     []byte //还没有读完的一行
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.observed {
+		b.line = append(b.line, p[:n]...)
+		for !b.observed {
+			i := bytes.IndexByte(b.line, '\n')
+			if i < 0 {
+				break
+			}
+			if sse.Content(b.line[:i]) {
+				b.observe()
+			}
+			b.line = b.line[i+1:]
+		}
+		if b.observed {
+			b.line = nil
+		}
+	}
+	return n, err
+}
+
+func (b *trackedBody) observe() {
+	b.observed = true
+	latency := time.Since(b.tracker.start)
+	for _, s := range b.tracker.stats {
+		s.observe(latency)
+	}
+}
+
+func (b *trackedBody) Close() error {
+	b.tracker.Done()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,195 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/xiaoxiongmao5/we-api/common/config"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/tokenizer"
+	"github.com/xiaoxiongmao5/we-api/store"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+// 计费方式
+const (
+	ModeToken = "token" //1 额度 = 1 token
+	ModeMoney = "money" //按模型价格折算成额度
+)
+
+const (
+	defaultQuotaPerUSD = 500000
+	defaultImageQuota  = 1000
+)
+
+var settings = config.Quota{Mode: ModeToken}
+
+// Init 需要在 registry.Init 之后调用，按金额计费时所有模型都需要配置价格
+func Init(quota config.Quota) error {
+	switch quota.Mode {
+	case "":
+		quota.Mode = ModeToken
+	case ModeToken, ModeMoney:
+	default:
+		return fmt.Errorf("unknown quota mode %q", quota.Mode)
+	}
+	if quota.PerUSD <= 0 {
+		quota.PerUSD = defaultQuotaPerUSD
+	}
+	if quota.Image <= 0 {
+		quota.Image = defaultImageQuota
+	}
+	if quota.Mode == ModeMoney {
+		// 没有价格的模型无法折算成金额，混用 token 数会让余额失去意义
+		for _, m := range registry.Models() {
+			if m.Pricing == nil {
+				return fmt.Errorf("model %s: pricing is required in money quota mode", m.Name)
+			}
+			if m.Support(registry.CapabilityImage) && len(m.Pricing.Image) == 0 {
+				return fmt.Errorf("model %s: pricing.image is required in money quota mode", m.Name)
+			}
+		}
+	}
+	settings = quota
+	return nil
+}
+
+// Cost 计算用量对应的额度，按 token 计费时 1 个 token 算 1 额度
+func Cost(m *registry.Model, promptTokens int, completionTokens int) int64 {
+	if settings.Mode == ModeMoney && m != nil && m.Pricing != nil {
+		usd := (float64(promptTokens)*m.Pricing.Input + float64(completionTokens)*m.Pricing.Output) / 1e6
+		return int64(math.Ceil(usd * settings.PerUSD))
+	}
+	return int64(promptTokens + completionTokens)
+}
+
+// UsageCost 按实际用量计算额度，音频 token 配置了单独价格时分开计算
+func UsageCost(m *registry.Model, usage *model.Usage) int64 {
+	if usage.Type == "duration" {
+		return AudioDurationCost(m, usage.Seconds)
+	}
+	if settings.Mode != ModeMoney || m == nil || m.Pricing == nil {
+		return Cost(m, usage.PromptTokens, usage.CompletionTokens)
+	}
+
+	var audioInput, audioOutput int
+	if usage.PromptTokensDetails != nil && m.Pricing.AudioInput > 0 {
+		audioInput = usage.PromptTokensDetails.AudioTokens
+	}
+	if usage.CompletionTokensDetails != nil && m.Pricing.AudioOutput > 0 {
+		audioOutput = usage.CompletionTokensDetails.AudioTokens
+	}
+	usd := (float64(usage.PromptTokens-audioInput)*m.Pricing.Input +
+		float64(audioInput)*m.Pricing.AudioInput +
+		float64(usage.CompletionTokens-audioOutput)*m.Pricing.Output +
+		float64(audioOutput)*m.Pricing.AudioOutput) / 1e6
+	return int64(math.Ceil(usd * settings.PerUSD))
+}
+
+// AudioDurationCost 按音频时长计算额度，没有配置价格时按音频 token 数计费
+func AudioDurationCost(m *registry.Model, seconds float64) int64 {
+	if settings.Mode == ModeMoney && m != nil && m.Pricing != nil && m.Pricing.Minute > 0 {
+		return int64(math.Ceil(seconds / 60 * m.Pricing.Minute * settings.PerUSD))
+	}
+	return Cost(m, int(math.Ceil(seconds*tokenizer.AudioTokensPerSecond)), 0)
+}
+
+// SpeechCost 按字符数计算语音合成的额度，没有配置价格时 1 个字符按 1 个 token 计费
+func SpeechCost(m *registry.Model, characters int) int64 {
+	if settings.Mode == ModeMoney && m != nil && m.Pricing != nil && m.Pricing.Character > 0 {
+		return int64(math.Ceil(float64(characters) * m.Pricing.Character / 1e6 * settings.PerUSD))
+	}
+	return Cost(m, characters, 0)
+}
+
+// ImageCost 按图片的张数计算额度。配置了图片价格时优先匹配 质量:尺寸，都没有匹配时返回 false，视为不支持该尺寸；
+// 按 token 计费时每张图片按 quota.image 计算
+func ImageCost(m *registry.Model, size string, quality string, n int) (int64, bool) {
+	var price float64
+	if m != nil && m.Pricing != nil && len(m.Pricing.Image) > 0 {
+		var ok bool
+		price, ok = m.Pricing.Image[quality+":"+size]
+		if !ok {
+			price, ok = m.Pricing.Image[size]
+		}
+		if !ok {
+			return 0, false
+		}
+	}
+	if settings.Mode == ModeMoney {
+		return int64(math.Ceil(price * float64(n) * settings.PerUSD)), true
+	}
+	return int64(n) * settings.Image, true
+}
+
+func insufficientQuotaError() *model.ErrorWithStatusCode {
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: "You exceeded your current quota, please check your plan and billing details.",
+			Type:    "insufficient_quota",
+			Code:    "insufficient_quota",
+		},
+		StatusCode: http.StatusTooManyRequests,
+	}
+}
+
+// PreConsume 请求上游之前按预估额度预扣，额度不足时返回 429
+func PreConsume(meta *meta.Meta, quota int64) *model.ErrorWithStatusCode {
+	if quota <= 0 {
+		return nil
+	}
+	err := store.PreConsumeQuota(meta.TokenId, meta.UserId, quota)
+	if errors.Is(err, store.ErrInsufficientQuota) {
+		return insufficientQuotaError()
+	}
+	if err != nil {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: err.Error(),
+				Type:    "we_api_error",
+				Code:    "pre_consume_quota_failed",
+			},
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	meta.PreConsumedQuota = quota
+	return nil
+}
+
+// PostConsume 按实际用量结算，上游没有返回 usage 时按预扣额度计费
+func PostConsume(ctx context.Context, meta *meta.Meta, usage *model.Usage) {
+	logger := utils.Log(ctx, "PostConsume")
+	if usage == nil {
+		logger.Info("usage is nil, keep pre-consumed quota", xlog.Int64("quota", meta.PreConsumedQuota))
+		return
+	}
+
+	modelInfo, _ := registry.Resolve(meta.FullMode)
+	quota := UsageCost(modelInfo, usage)
+	if err := store.AdjustQuota(meta.TokenId, meta.UserId, quota-meta.PreConsumedQuota); err != nil {
+		logger.Error("store.AdjustQuota err", xlog.Err(err))
+		return
+	}
+	logger.Info("quota consumed",
+		xlog.Int64("quota", quota),
+		xlog.Int64("preConsumedQuota", meta.PreConsumedQuota),
+		xlog.Any("usage", usage))
+}
+
+// Refund 请求失败时退还预扣的额度
+func Refund(ctx context.Context, meta *meta.Meta) {
+	if meta.PreConsumedQuota == 0 {
+		return
+	}
+	if err := store.AdjustQuota(meta.TokenId, meta.UserId, -meta.PreConsumedQuota); err != nil {
+		utils.Log(ctx, "Refund").Error("store.AdjustQuota err", xlog.Err(err))
+		return
+	}
+	meta.PreConsumedQuota = 0
+}
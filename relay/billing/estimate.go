@@ -0,0 +1,30 @@
+package billing
+
+import (
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/tokenizer"
+)
+
+// EstimatePromptTokens 用本地分词器计算提示词的 token 数
+func EstimatePromptTokens(request *model.GeneralOpenAIRequest, modelName string) int {
+	// 向量请求只计算 input，token 数组按长度计算
+	if request.Input != nil {
+		return tokenizer.CountTokenInput(request.ParseInput(), modelName) + request.InputTokens()
+	}
+	// 文本补全请求只计算 prompt 和 suffix，token 数组按长度计算
+	if request.Prompt != nil {
+		return tokenizer.CountTokenInput(append(request.ParsePrompt(), request.Suffix), modelName) + request.PromptTokens()
+	}
+	return tokenizer.CountTokenRequest(request, modelName)
+}
+
+// EstimateCompletionTokens 以请求的最大输出 token 数作为预估
+func EstimateCompletionTokens(request *model.GeneralOpenAIRequest) int {
+	if request.MaxTokens > 0 {
+		return request.MaxTokens
+	}
+	if request.MaxCompletionTokens != nil {
+		return *request.MaxCompletionTokens
+	}
+	return 0
+}
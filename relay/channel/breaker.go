@@ -0,0 +1,225 @@
+package channel
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Fault 上游请求失败的归因
+type Fault int
+
+const (
+	FaultNone     Fault = iota //成功，或者是调用方的请求有问题
+	FaultChannel               //网络错误、超时和 5xx，渠道不可用
+	FaultKey                   //限流，key 暂时不可用
+	FaultKeyFatal              //key 无效或额度用完，短时间内不会恢复
+)
+
+// 上游额度用完时错误信息中的关键字，429 也可能只是短时间的限流，需要区分
+var quotaExhaustedMarkers = [][]byte{
+	[]byte("insufficient_quota"),
+	[]byte("billing_hard_limit_reached"),
+	[]byte("credit balance is too low"),
+}
+
+// Classify 按上游的响应判断失败的归因，statusCode 为 0 表示请求没有发出或者没有收到响应
+func Classify(statusCode int, body []byte) (Fault, string) {
+	for _, marker := range quotaExhaustedMarkers {
+		if statusCode >= http.StatusBadRequest && bytes.Contains(body, marker) {
+			return FaultKeyFatal, "quota exhausted"
+		}
+	}
+	switch {
+	case statusCode == 0:
+		return FaultChannel, "request failed"
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return FaultKeyFatal, "invalid key"
+	case statusCode == http.StatusPaymentRequired:
+		return FaultKeyFatal, "quota exhausted"
+	case statusCode == http.StatusTooManyRequests:
+		return FaultKey, "rate limited"
+	case statusCode == http.StatusRequestTimeout || statusCode >= http.StatusInternalServerError:
+		return FaultChannel, "upstream error"
+	}
+	return FaultNone, ""
+}
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"    //正常使用
+	StateOpen     = "open"      //已停用，冷却时间过后放行一个探测请求
+	StateHalfOpen = "half_open" //探测请求进行中，成功后恢复，失败后重新停用
+)
+
+const (
+	// 按最近 windowSize 次请求计算失败率
+	windowSize = 20
+	// 请求数达到 minRequests 后失败率超过 maxFailureRate 时停用
+	minRequests    = 10
+	maxFailureRate = 0.5
+	// 连续失败 maxConsecutiveFailures 次时停用
+	maxConsecutiveFailures = 5
+	// 停用后的冷却时间，探测失败时翻倍，最长 maxCooldown
+	baseCooldown = 30 * time.Second
+	maxCooldown  = 10 * time.Minute
+	// key 无效或额度用完时直接按最长冷却时间停用
+	fatalCooldown = maxCooldown
+	// 探测请求超过该时间没有结果时允许再次探测，避免请求中途取消后一直处于半开状态
+	probeTimeout = time.Minute
+)
+
+// breaker 渠道和 key 各有一个熔断器，记录最近的请求结果
+type breaker struct {
+	mu          sync.Mutex
+	state       string
+	results     [windowSize]bool //环形缓冲区，true 表示失败
+	count       int
+	pos         int
+	consecutive int
+	cooldown    time.Duration
+	openedAt    time.Time
+	probeAt     time.Time
+	reason      string
+}
+
+// BreakerStatus 熔断器的当前状态，用于展示
+type BreakerStatus struct {
+	State               string  `json:"state"`
+	Reason              string  `json:"reason,omitempty"`      //停用原因
+	DisabledAt          int64   `json:"disabled_at,omitempty"` //停用时间
+	RetryAt             int64   `json:"retry_at,omitempty"`    //下次探测的时间
+	FailureRate         float64 `json:"failure_rate"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+}
+
+func newBreaker() *breaker {
+	return &breaker{state: StateClosed}
+}
+
+// ready 判断是否可以使用，不改变状态
+func (b *breaker) ready(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.readyLocked(now)
+}
+
+func (b *breaker) readyLocked(now time.Time) bool {
+	switch b.state {
+	case StateOpen:
+		return now.Sub(b.openedAt) >= b.cooldown
+	case StateHalfOpen:
+		return now.Sub(b.probeAt) >= probeTimeout
+	}
+	return true
+}
+
+// allow 选中后调用，停用状态下冷却时间已过时转为半开并放行这一个探测请求
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.readyLocked(now) {
+		return false
+	}
+	if b.state != StateClosed {
+		b.state = StateHalfOpen
+		b.probeAt = now
+	}
+	return true
+}
+
+// release 探测请求没有发出或者中途取消、不反馈结果时调用，回到冷却时间已过的停用状态，下一个请求可以立即探测
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen {
+		b.state = StateOpen
+	}
+}
+
+// success 返回 true 表示从停用中恢复
+func (b *breaker) success() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.record(false)
+	b.consecutive = 0
+	if b.state == StateClosed {
+		return false
+	}
+	b.state = StateClosed
+	b.cooldown = 0
+	b.reason = ""
+	// 恢复后重新统计，避免停用前的失败再次触发熔断
+	b.count = 0
+	b.pos = 0
+	return true
+}
+
+// failure 返回 true 表示本次失败导致停用。fatal 的失败短时间内不会恢复，直接按最长冷却时间停用
+func (b *breaker) failure(now time.Time, reason string, fatal bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.record(true)
+	b.consecutive++
+
+	switch {
+	case b.state == StateHalfOpen:
+		// 探测失败，冷却时间翻倍
+		b.open(now, reason, min(b.cooldown*2, maxCooldown))
+	case b.state == StateOpen:
+		// 停用前已经发出的请求
+		return false
+	case fatal:
+		b.open(now, reason, fatalCooldown)
+	case b.consecutive >= maxConsecutiveFailures || (b.count >= minRequests && b.failureRate() >= maxFailureRate):
+		b.open(now, reason, baseCooldown)
+	default:
+		return false
+	}
+	return true
+}
+
+func (b *breaker) open(now time.Time, reason string, cooldown time.Duration) {
+	b.state = StateOpen
+	b.openedAt = now
+	b.cooldown = max(cooldown, baseCooldown)
+	b.reason = reason
+}
+
+func (b *breaker) record(failed bool) {
+	b.results[b.pos] = failed
+	b.pos = (b.pos + 1) % windowSize
+	if b.count < windowSize {
+		b.count++
+	}
+}
+
+func (b *breaker) failureRate() float64 {
+	if b.count == 0 {
+		return 0
+	}
+	failures := 0
+	for i := 0; i < b.count; i++ {
+		if b.results[i] {
+			failures++
+		}
+	}
+	return float64(failures) / float64(b.count)
+}
+
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BreakerStatus{
+		State:               b.state,
+		Reason:              b.reason,
+		FailureRate:         b.failureRate(),
+		ConsecutiveFailures: b.consecutive,
+	}
+	if b.state != StateClosed {
+		status.DisabledAt = b.openedAt.Unix()
+		status.RetryAt = b.openedAt.Add(b.cooldown).Unix()
+	}
+	return status
+}
@@ -0,0 +1,221 @@
+package channel
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       Fault
+	}{
+		{"ok", http.StatusOK, "", FaultNone},
+		{"bad request", http.StatusBadRequest, `{"error":{"message":"invalid"}}`, FaultNone},
+		{"not found", http.StatusNotFound, "", FaultNone},
+		{"no response", 0, "", FaultChannel},
+		{"unauthorized", http.StatusUnauthorized, "", FaultKeyFatal},
+		{"forbidden", http.StatusForbidden, "", FaultKeyFatal},
+		{"payment required", http.StatusPaymentRequired, "", FaultKeyFatal},
+		{"rate limited", http.StatusTooManyRequests, `{"error":{"type":"rate_limit_exceeded"}}`, FaultKey},
+		{"quota exhausted", http.StatusTooManyRequests, `{"error":{"code":"insufficient_quota"}}`, FaultKeyFatal},
+		{"billing limit", http.StatusBadRequest, `{"error":{"code":"billing_hard_limit_reached"}}`, FaultKeyFatal},
+		{"credit balance", http.StatusBadRequest, `Your credit balance is too low`, FaultKeyFatal},
+		{"marker in success", http.StatusOK, `insufficient_quota`, FaultNone},
+		{"request timeout", http.StatusRequestTimeout, "", FaultChannel},
+		{"server error", http.StatusInternalServerError, "", FaultChannel},
+		{"bad gateway", http.StatusBadGateway, "", FaultChannel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := Classify(tt.statusCode, []byte(tt.body)); got != tt.want {
+				t.Errorf("Classify(%d, %q) = %v, want %v", tt.statusCode, tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+// breakerStep 在 at 时刻对熔断器执行一次操作，want 为操作的返回值
+type breakerStep struct {
+	op   string //ok fail fatal ready allow release
+	at   time.Duration
+	want bool
+}
+
+func repeat(n int, step breakerStep) []breakerStep {
+	steps := make([]breakerStep, n)
+	for i := range steps {
+		steps[i] = step
+	}
+	return steps
+}
+
+func concat(steps ...[]breakerStep) []breakerStep {
+	var result []breakerStep
+	for _, s := range steps {
+		result = append(result, s...)
+	}
+	return result
+}
+
+func TestBreaker(t *testing.T) {
+	tripped := repeat(maxConsecutiveFailures-1, breakerStep{op: "fail"})
+	tripped = append(tripped, breakerStep{op: "fail", want: true})
+
+	tests := []struct {
+		name         string
+		steps        []breakerStep
+		wantState    string
+		wantCooldown time.Duration
+	}{
+		{
+			name:      "closed below thresholds",
+			steps:     concat(repeat(maxConsecutiveFailures-1, breakerStep{op: "fail"}), []breakerStep{{op: "ok"}, {op: "ready", want: true}}),
+			wantState: StateClosed,
+		},
+		{
+			name:         "consecutive failures open",
+			steps:        tripped,
+			wantState:    StateOpen,
+			wantCooldown: baseCooldown,
+		},
+		{
+			name: "failure rate opens",
+			steps: concat(
+				repeat(minRequests/2-1, breakerStep{op: "ok"}),
+				[]breakerStep{{op: "fail"}, {op: "fail"}, {op: "fail"}, {op: "fail"}, {op: "ok"}, {op: "fail", want: true}},
+			),
+			wantState:    StateOpen,
+			wantCooldown: baseCooldown,
+		},
+		{
+			name:         "fatal opens with fatal cooldown",
+			steps:        []breakerStep{{op: "fatal", want: true}, {op: "ready", at: maxCooldown - time.Second}},
+			wantState:    StateOpen,
+			wantCooldown: fatalCooldown,
+		},
+		{
+			name:         "failures while open are ignored",
+			steps:        []breakerStep{{op: "fatal", want: true}, {op: "fail"}, {op: "fatal"}},
+			wantState:    StateOpen,
+			wantCooldown: fatalCooldown,
+		},
+		{
+			name: "ready does not change state",
+			steps: concat(tripped, []breakerStep{
+				{op: "ready", at: baseCooldown - time.Second},
+				{op: "ready", at: baseCooldown, want: true},
+				{op: "ready", at: baseCooldown, want: true},
+			}),
+			wantState:    StateOpen,
+			wantCooldown: baseCooldown,
+		},
+		{
+			name: "cooldown allows one probe",
+			steps: concat(tripped, []breakerStep{
+				{op: "allow", at: baseCooldown - time.Second},
+				{op: "allow", at: baseCooldown, want: true},
+				{op: "allow", at: baseCooldown + time.Second},
+				{op: "ready", at: baseCooldown + time.Second},
+			}),
+			wantState:    StateHalfOpen,
+			wantCooldown: baseCooldown,
+		},
+		{
+			name: "probe timeout allows another probe",
+			steps: concat(tripped, []breakerStep{
+				{op: "allow", at: baseCooldown, want: true},
+				{op: "allow", at: baseCooldown + probeTimeout, want: true},
+			}),
+			wantState:    StateHalfOpen,
+			wantCooldown: baseCooldown,
+		},
+		{
+			name: "released probe allows another probe",
+			steps: concat(tripped, []breakerStep{
+				{op: "allow", at: baseCooldown, want: true},
+				{op: "release", at: baseCooldown},
+				{op: "ready", at: baseCooldown + time.Second, want: true},
+				{op: "allow", at: baseCooldown + time.Second, want: true},
+			}),
+			wantState:    StateHalfOpen,
+			wantCooldown: baseCooldown,
+		},
+		{
+			name:      "release while closed does nothing",
+			steps:     []breakerStep{{op: "release"}, {op: "ready", want: true}},
+			wantState: StateClosed,
+		},
+		{
+			name: "probe success closes",
+			steps: concat(tripped, []breakerStep{
+				{op: "allow", at: baseCooldown, want: true},
+				{op: "ok", at: baseCooldown, want: true},
+				{op: "ok", at: baseCooldown},
+				{op: "allow", at: baseCooldown, want: true},
+			}),
+			wantState: StateClosed,
+		},
+		{
+			name: "probe failure doubles cooldown",
+			steps: concat(tripped, []breakerStep{
+				{op: "allow", at: baseCooldown, want: true},
+				{op: "fail", at: baseCooldown, want: true},
+				{op: "allow", at: 3*baseCooldown - time.Second},
+				{op: "allow", at: 3 * baseCooldown, want: true},
+				{op: "fail", at: 3 * baseCooldown, want: true},
+			}),
+			wantState:    StateOpen,
+			wantCooldown: 4 * baseCooldown,
+		},
+		{
+			name: "cooldown doubling stops at max",
+			steps: []breakerStep{
+				{op: "fatal", want: true},
+				{op: "allow", at: fatalCooldown, want: true},
+				{op: "fail", at: fatalCooldown, want: true},
+			},
+			wantState:    StateOpen,
+			wantCooldown: maxCooldown,
+		},
+	}
+
+	start := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker()
+			for i, step := range tt.steps {
+				now := start.Add(step.at)
+				var got bool
+				switch step.op {
+				case "ok":
+					got = b.success()
+				case "fail":
+					got = b.failure(now, "upstream error", false)
+				case "fatal":
+					got = b.failure(now, "invalid key", true)
+				case "ready":
+					got = b.ready(now)
+				case "allow":
+					got = b.allow(now)
+				case "release":
+					b.release()
+				default:
+					t.Fatalf("unknown op %q", step.op)
+				}
+				if got != step.want {
+					t.Fatalf("step %d %s at %s = %v, want %v", i, step.op, step.at, got, step.want)
+				}
+			}
+			if b.state != tt.wantState {
+				t.Errorf("state = %s, want %s", b.state, tt.wantState)
+			}
+			if b.cooldown != tt.wantCooldown {
+				t.Errorf("cooldown = %s, want %s", b.cooldown, tt.wantCooldown)
+			}
+		})
+	}
+}
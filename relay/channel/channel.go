@@ -0,0 +1,326 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaoxiongmao5/we-api/common/config"
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/relay/balancer"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+	"github.com/xiaoxiongmao5/we-api/relay/timeout"
+	"github.com/xiaoxiongmao5/we-api/utils"
+	"github.com/xiaoxiongmao5/we-api/xlog"
+)
+
+var ErrNoAvailableChannel = errors.New("no available channel")
+
+type Channel struct {
+	config.Channel
+	keyIndex atomic.Uint64
+	breaker  *breaker
+	stats    balancer.Stats
+	// key -> 熔断器和负载统计，每个 key 单独统计
+	keyBreakers map[string]*breaker
+	keyStats    map[string]*balancer.Stats
+}
+
+func (ch *Channel) IsEnabled() bool {
+	return ch.Enabled == nil || *ch.Enabled
+}
+
+// CanServe 判断渠道能否服务该模型，模型名和别名都可以出现在渠道的 models 中
+func (ch *Channel) CanServe(m *registry.Model) bool {
+	if ch.Type != m.Type {
+		return false
+	}
+	if len(ch.Models) == 0 {
+		return true
+	}
+	if slices.Contains(ch.Models, m.Name) {
+		return true
+	}
+	for _, alias := range m.Aliases {
+		if slices.Contains(ch.Models, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// PickKey 按策略选择 key，跳过已停用的 key，优先选择 exclude 之外的；所有 key 都已停用时仍然轮流返回，由熔断器继续统计。
+// 没有配置 key 时返回空字符串
+func (ch *Channel) PickKey(strategy string, exclude ...string) string {
+	return ch.pickKey(strategy, true, exclude...)
+}
+
+// PeekKey 与 PickKey 相同，但不改变熔断器的状态，选中后通过 Acquire 占用探测名额
+func (ch *Channel) PeekKey(strategy string, exclude ...string) string {
+	return ch.pickKey(strategy, false, exclude...)
+}
+
+// NextKey 多个 key 时轮流使用，跳过已停用的 key。不改变熔断器的状态，用于不会反馈请求结果的调用方，例如查询模型列表
+func (ch *Channel) NextKey() string {
+	return ch.pickKey(balancer.StrategyWeighted, false)
+}
+
+// pickKey probe 为 true 时选中的 key 冷却时间已过则转为半开，作为探测请求，调用方需要反馈请求结果
+func (ch *Channel) pickKey(strategy string, probe bool, exclude ...string) string {
+	if len(ch.Keys) == 0 {
+		return ""
+	}
+	now := time.Now()
+	start := ch.keyIndex.Add(1) - 1
+	var others, excluded []string
+	for i := range uint64(len(ch.Keys)) {
+		key := ch.Keys[(start+i)%uint64(len(ch.Keys))]
+		if !ch.keyBreakers[key].ready(now) {
+			continue
+		}
+		if slices.Contains(exclude, key) {
+			excluded = append(excluded, key)
+		} else {
+			others = append(others, key)
+		}
+	}
+
+	for _, keys := range [][]string{others, excluded} {
+		for len(keys) > 0 {
+			// key 没有权重，weighted 时按顺序轮流使用
+			i := 0
+			if strategy != balancer.StrategyWeighted {
+				candidates := make([]balancer.Candidate, 0, len(keys))
+				for _, key := range keys {
+					candidates = append(candidates, balancer.Candidate{Stats: ch.keyStats[key]})
+				}
+				i = balancer.Pick(strategy, candidates)
+			}
+			if !probe || ch.keyBreakers[keys[i]].allow(now) {
+				return keys[i]
+			}
+			keys = slices.Delete(keys, i, i+1)
+		}
+	}
+	return ch.Keys[start%uint64(len(ch.Keys))]
+}
+
+// Acquire 占用 Peek 和 PeekKey 选出的渠道和 key，冷却时间已过时转为半开作为探测请求，调用方需要反馈请求结果。
+// 选出之后渠道或 key 已经不能使用时返回 false
+func (ch *Channel) Acquire(key string) bool {
+	now := time.Now()
+	if !ch.breaker.allow(now) {
+		return false
+	}
+	if b := ch.keyBreakers[key]; b != nil && !b.allow(now) {
+		ch.breaker.release()
+		return false
+	}
+	return true
+}
+
+// Release 选中的渠道和 key 最终没有反馈请求结果时调用，例如调用方取消了请求，释放占用的探测名额，不记录成功或失败
+func (ch *Channel) Release(key string) {
+	ch.breaker.release()
+	if b := ch.keyBreakers[key]; b != nil {
+		b.release()
+	}
+}
+
+// Stats 渠道的负载统计
+func (ch *Channel) Stats() *balancer.Stats {
+	return &ch.stats
+}
+
+// KeyStats key 的负载统计，key 不属于该渠道时返回 nil
+func (ch *Channel) KeyStats(key string) *balancer.Stats {
+	return ch.keyStats[key]
+}
+
+// ready 渠道和至少一个 key 没有停用
+func (ch *Channel) ready(now time.Time) bool {
+	if !ch.breaker.ready(now) {
+		return false
+	}
+	if len(ch.Keys) == 0 {
+		return true
+	}
+	for _, b := range ch.keyBreakers {
+		if b.ready(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report 记录一次上游请求的结果，连续失败或失败率过高时自动停用渠道或 key，停用后的探测请求成功时自动恢复
+func (ch *Channel) Report(key string, fault Fault, reason string) {
+	now := time.Now()
+	logger := utils.Log(context.Background(), "channel.Report")
+	keyBreaker := ch.keyBreakers[key]
+
+	switch {
+	case fault == FaultChannel || (fault != FaultNone && keyBreaker == nil):
+		// 没有配置 key 时 key 的错误也算在渠道上
+		if ch.breaker.failure(now, reason, fault == FaultKeyFatal) {
+			logger.Error("channel disabled", xlog.Int64("channelId", int64(ch.Id)), xlog.String("reason", reason))
+		}
+		return
+	case ch.breaker.success():
+		logger.Info("channel enabled", xlog.Int64("channelId", int64(ch.Id)))
+	}
+
+	if keyBreaker == nil {
+		return
+	}
+	if fault == FaultNone {
+		if keyBreaker.success() {
+			logger.Info("channel key enabled", xlog.Int64("channelId", int64(ch.Id)), xlog.String("key", maskKey(key)))
+		}
+		return
+	}
+	if keyBreaker.failure(now, reason, fault == FaultKeyFatal) {
+		logger.Error("channel key disabled", xlog.Int64("channelId", int64(ch.Id)), xlog.String("key", maskKey(key)), xlog.String("reason", reason))
+	}
+}
+
+// KeyStatus key 的熔断器状态，key 只展示首尾几位
+type KeyStatus struct {
+	Key string `json:"key"`
+	BreakerStatus
+}
+
+// Status 渠道和各个 key 的熔断器状态
+func (ch *Channel) Status() (BreakerStatus, []KeyStatus) {
+	keys := make([]KeyStatus, 0, len(ch.Keys))
+	for _, key := range ch.Keys {
+		keys = append(keys, KeyStatus{Key: maskKey(key), BreakerStatus: ch.keyBreakers[key].status()})
+	}
+	return ch.breaker.status(), keys
+}
+
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
+
+var (
+	mu       sync.RWMutex
+	channels []*Channel
+)
+
+func Init(channelConfigs []config.Channel) error {
+	newChannels := make([]*Channel, 0, len(channelConfigs))
+	ids := make(map[int]bool, len(channelConfigs))
+
+	for _, channelConfig := range channelConfigs {
+		if channelConfig.Id <= 0 {
+			return fmt.Errorf("channel %s: id must be positive", channelConfig.Name)
+		}
+		if ids[channelConfig.Id] {
+			return fmt.Errorf("channel id %d is duplicated", channelConfig.Id)
+		}
+		if !apitype.IsValid(channelConfig.Type) {
+			return fmt.Errorf("channel %d: unknown type %q", channelConfig.Id, channelConfig.Type)
+		}
+		if channelConfig.Weight < 0 {
+			return fmt.Errorf("channel %d: weight must not be negative", channelConfig.Id)
+		}
+		if !timeout.Valid(channelConfig.Timeouts) {
+			return fmt.Errorf("channel %d: timeouts must not be negative", channelConfig.Id)
+		}
+		ids[channelConfig.Id] = true
+		ch := &Channel{
+			Channel:     channelConfig,
+			breaker:     newBreaker(),
+			keyBreakers: make(map[string]*breaker, len(channelConfig.Keys)),
+			keyStats:    make(map[string]*balancer.Stats, len(channelConfig.Keys)),
+		}
+		for _, key := range channelConfig.Keys {
+			ch.keyBreakers[key] = newBreaker()
+			ch.keyStats[key] = &balancer.Stats{}
+		}
+		newChannels = append(newChannels, ch)
+	}
+
+	mu.Lock()
+	channels = newChannels
+	mu.Unlock()
+
+	return nil
+}
+
+func Channels() []*Channel {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return channels
+}
+
+// Get 按 id 查找渠道
+func Get(id int) *Channel {
+	for _, ch := range Channels() {
+		if ch.Id == id {
+			return ch
+		}
+	}
+	return nil
+}
+
+// Select 按模型所在分组的负载均衡策略从能服务该模型的已启用渠道中选择一个，跳过被熔断停用的渠道。
+// 重试时通过 exclude 排除已经失败的渠道，没有其它渠道时仍然从这些渠道中选择
+func Select(m *registry.Model, exclude ...int) (*Channel, error) {
+	return selectChannel(m, true, exclude...)
+}
+
+// Peek 与 Select 相同，但不改变熔断器的状态，选中后通过 Acquire 占用探测名额
+func Peek(m *registry.Model, exclude ...int) (*Channel, error) {
+	return selectChannel(m, false, exclude...)
+}
+
+// selectChannel probe 为 true 时选中的渠道冷却时间已过则转为半开，作为探测请求，调用方需要反馈请求结果
+func selectChannel(m *registry.Model, probe bool, exclude ...int) (*Channel, error) {
+	now := time.Now()
+	var others, excluded []*Channel
+	for _, ch := range Channels() {
+		if !ch.IsEnabled() || !ch.CanServe(m) || !ch.ready(now) {
+			continue
+		}
+		if slices.Contains(exclude, ch.Id) {
+			excluded = append(excluded, ch)
+		} else {
+			others = append(others, ch)
+		}
+	}
+
+	strategy := balancer.StrategyFor(m)
+	for _, candidates := range [][]*Channel{others, excluded} {
+		for len(candidates) > 0 {
+			i := pick(strategy, candidates)
+			// 停用的渠道冷却时间已过时只放行一个探测请求
+			if !probe || candidates[i].breaker.allow(now) {
+				return candidates[i], nil
+			}
+			candidates = slices.Delete(candidates, i, i+1)
+		}
+	}
+	return nil, ErrNoAvailableChannel
+}
+
+func pick(strategy string, channels []*Channel) int {
+	candidates := make([]balancer.Candidate, 0, len(channels))
+	for _, ch := range channels {
+		candidates = append(candidates, balancer.Candidate{
+			Priority: ch.Priority,
+			Weight:   ch.Weight,
+			Stats:    &ch.stats,
+		})
+	}
+	return balancer.Pick(strategy, candidates)
+}
@@ -0,0 +1,23 @@
+package model
+
+import "net/url"
+
+// https://platform.openai.com/docs/api-reference/audio/createSpeech
+type TextToSpeechRequest struct {
+	Model          string   `json:"model"`
+	Input          string   `json:"input"`
+	Voice          string   `json:"voice"`
+	Instructions   string   `json:"instructions,omitempty"`
+	ResponseFormat string   `json:"response_format,omitempty"` //mp3 opus aac flac wav pcm
+	Speed          *float64 `json:"speed,omitempty"`
+}
+
+// AudioRequest 转写和翻译接口的 multipart 表单
+// https://platform.openai.com/docs/api-reference/audio/createTranscription
+type AudioRequest struct {
+	Model          string
+	File           []byte
+	FileName       string
+	ResponseFormat string     //json text srt verbose_json vtt
+	Fields         url.Values //其它表单字段，例如 language prompt timestamp_granularities[]，同名字段的每个值都原样转发
+}
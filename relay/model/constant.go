@@ -5,3 +5,18 @@ const (
 	ContentTypeImageURL   = "image_url"
 	ContentTypeInputAudio = "input_audio"
 )
+
+const (
+	RoleSystem    = "system"
+	RoleDeveloper = "developer"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+const ToolTypeFunction = "function"
+
+const (
+	ModalityText  = "text"
+	ModalityAudio = "audio"
+)
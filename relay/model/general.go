@@ -66,38 +66,128 @@ type GeneralOpenAIRequest struct {
 	User                string          `json:"user,omitempty"`
 	FunctionCall        any             `json:"function_call,omitempty"`
 	Functions           any             `json:"functions,omitempty"`
-	// // https://platform.openai.com/docs/api-reference/embeddings/create
-	// Input any `json:"input,omitempty"`
-	// EncodingFormat string `json:"encoding_format,omitempty"`
-	// Dimensions     int    `json:"dimensions,omitempty"`
-	// // https://platform.openai.com/docs/api-reference/images/create
-	// Prompt  any     `json:"prompt,omitempty"`
-	// Quality *string `json:"quality,omitempty"`
-	// Size    string  `json:"size,omitempty"`
-	// Style   *string `json:"style,omitempty"`
+	// https://platform.openai.com/docs/api-reference/embeddings/create
+	Input          any    `json:"input,omitempty"`
+	EncodingFormat string `json:"encoding_format,omitempty"` //float base64
+	Dimensions     int    `json:"dimensions,omitempty"`
+	// https://platform.openai.com/docs/api-reference/completions/create
+	Prompt any    `json:"prompt,omitempty"` //字符串、字符串数组或者 token 数组
+	Suffix string `json:"suffix,omitempty"`
+	Echo   bool   `json:"echo,omitempty"`
+	BestOf int    `json:"best_of,omitempty"`
+	// 文本补全接口的 logprobs 为返回的候选数，与对话接口的同名字段类型不同，由 CompletionsRequest 解析
+	CompletionLogprobs *int `json:"-"`
 	// // Others
 	// Instruction string `json:"instruction,omitempty"`
 	// NumCtx      int    `json:"num_ctx,omitempty"`
 }
 
-// func (r GeneralOpenAIRequest) ParseInput() []string {
-// 	if r.Input == nil {
-// 		return nil
-// 	}
-
-// 	var input []string
-
-// 	switch r.Input.(type) {
-// 	case string:
-// 		input = []string{r.Input.(string)}
-// 	case []any:
-// 		input = make([]string, len(r.Input.([]any)))
-// 		for _, item := range r.Input.([]any) {
-// 			if str, ok := item.(string); ok {
-// 				input = append(input, str)
-// 			}
-// 		}
-// 	}
-
-// 	return input
-// }
+// CompletionsRequest 文本补全接口的请求，logprobs 覆盖对话接口的同名字段
+type CompletionsRequest struct {
+	GeneralOpenAIRequest
+	Logprobs *int `json:"logprobs,omitempty"`
+}
+
+// PromptTokens token 数组形式的 prompt 中的 token 数，prompt 可以是 []int 或 [][]int
+func (r GeneralOpenAIRequest) PromptTokens() int {
+	return countTokenArray(r.Prompt)
+}
+
+// ParsePrompt 只返回文本形式的 prompt，token 数组会被忽略
+func (r GeneralOpenAIRequest) ParsePrompt() []string {
+	switch v := r.Prompt.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		prompt := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				prompt = append(prompt, str)
+			}
+		}
+		return prompt
+	}
+	return nil
+}
+
+func (r GeneralOpenAIRequest) ParseInput() []string {
+	if r.Input == nil {
+		return nil
+	}
+
+	var input []string
+
+	switch v := r.Input.(type) {
+	case string:
+		input = []string{v}
+	case []any:
+		input = make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				input = append(input, str)
+			}
+		}
+	}
+
+	return input
+}
+
+// InputTokens token 数组形式的 input 中的 token 数，input 可以是 []int 或 [][]int
+func (r GeneralOpenAIRequest) InputTokens() int {
+	return countTokenArray(r.Input)
+}
+
+// countTokenArray 计算 token 数组中的 token 数，json 中的数字解析为 float64
+func countTokenArray(v any) int {
+	items, ok := v.([]any)
+	if !ok {
+		return 0
+	}
+	count := 0
+	for _, item := range items {
+		switch item := item.(type) {
+		case float64:
+			count++
+		case []any:
+			for _, token := range item {
+				if _, ok := token.(float64); ok {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// HasAudioOutput 是否要求模型输出音频
+func (r GeneralOpenAIRequest) HasAudioOutput() bool {
+	for _, modality := range r.Modalities {
+		if modality == ModalityAudio {
+			return true
+		}
+	}
+	return r.Audio != nil
+}
+
+func (r GeneralOpenAIRequest) ParseStop() []string {
+	if r.Stop == nil {
+		return nil
+	}
+
+	var stop []string
+
+	switch v := r.Stop.(type) {
+	case string:
+		stop = []string{v}
+	case []string:
+		stop = v
+	case []any:
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				stop = append(stop, str)
+			}
+		}
+	}
+
+	return stop
+}
@@ -0,0 +1,14 @@
+package model
+
+// https://platform.openai.com/docs/api-reference/images/create
+type ImageRequest struct {
+	Model          string  `json:"model,omitempty"`
+	Prompt         string  `json:"prompt"`
+	N              int     `json:"n,omitempty"`
+	Size           string  `json:"size,omitempty"`            //1024x1024 1792x1024 1024x1792 等
+	Quality        string  `json:"quality,omitempty"`         //dall-e-3: standard hd，gpt-image-1: low medium high
+	ResponseFormat string  `json:"response_format,omitempty"` //url b64_json
+	Style          *string `json:"style,omitempty"`
+	Background     *string `json:"background,omitempty"`
+	User           string  `json:"user,omitempty"`
+}
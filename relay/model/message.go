@@ -6,12 +6,21 @@ package model
 */
 
 type Message struct {
-	Role             string  `json:"role,omitempty"` //消息作者的角色
-	Content          any     `json:"content,omitempty"`
-	ReasoningContent any     `json:"reasoning_content,omitempty"`
-	Name             *string `json:"name,omitempty"` //参与者的可选名称。提供模型信息以区分同一角色的参与者
-	// ToolCalls        []Tool  `json:"tool_calls,omitempty"`
-	// ToolCallId       string  `json:"tool_call_id,omitempty"`
+	Role             string        `json:"role,omitempty"` //消息作者的角色
+	Content          any           `json:"content,omitempty"`
+	ReasoningContent any           `json:"reasoning_content,omitempty"`
+	Name             *string       `json:"name,omitempty"`         //参与者的可选名称。提供模型信息以区分同一角色的参与者
+	ToolCalls        []ToolCall    `json:"tool_calls,omitempty"`   //assistant 消息中模型发起的工具调用
+	ToolCallId       string        `json:"tool_call_id,omitempty"` //tool 消息对应的工具调用 id
+	Audio            *MessageAudio `json:"audio,omitempty"`        //音频输出，流式响应中是增量
+}
+
+// MessageAudio 模型输出的音频，data 是 base64 编码的音频数据
+type MessageAudio struct {
+	Id         string `json:"id,omitempty"`
+	Data       string `json:"data,omitempty"`
+	ExpiresAt  int64  `json:"expires_at,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
 }
 
 type ImageURL struct {
@@ -19,10 +28,17 @@ type ImageURL struct {
 	Detail string `json:"detail,omitempty"`
 }
 
+// InputAudio 输入的音频，data 是 base64 编码的音频数据
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"` //wav mp3
+}
+
 type MessageContent struct {
-	Type     string    `json:"type,omitempty"`
-	Text     string    `json:"text"`
-	ImageURL *ImageURL `json:"image_url,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Text       string      `json:"text"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
 }
 
 func (m Message) IsStringContent() bool {
@@ -76,19 +92,31 @@ func (m Message) ParseContent() []MessageContent {
 			}
 			switch contentMap["type"] {
 			case ContentTypeText:
+				text, _ := contentMap["text"].(string)
 				conentList = append(conentList, MessageContent{
 					Type: ContentTypeText,
-					Text: contentMap["text"].(string),
+					Text: text,
 				})
 			case ContentTypeImageURL:
-				// [TODO]测试这里是否能映射成功
-				image_url, ok := contentMap["image_url"].(ImageURL)
-				if !ok {
+				// json 解码后 image_url 是 map，也兼容直接传 url 字符串的写法
+				imageURL := parseImageURL(contentMap["image_url"])
+				if imageURL == nil {
 					break
 				}
 				conentList = append(conentList, MessageContent{
 					Type:     ContentTypeImageURL,
-					ImageURL: &image_url,
+					ImageURL: imageURL,
+				})
+			case ContentTypeInputAudio:
+				inputAudio, ok := contentMap["input_audio"].(map[string]any)
+				if !ok {
+					break
+				}
+				data, _ := inputAudio["data"].(string)
+				format, _ := inputAudio["format"].(string)
+				conentList = append(conentList, MessageContent{
+					Type:       ContentTypeInputAudio,
+					InputAudio: &InputAudio{Data: data, Format: format},
 				})
 			}
 		}
@@ -96,3 +124,38 @@ func (m Message) ParseContent() []MessageContent {
 
 	return conentList
 }
+
+func parseImageURL(v any) *ImageURL {
+	switch imageURL := v.(type) {
+	case string:
+		return &ImageURL{Url: imageURL}
+	case map[string]any:
+		url, _ := imageURL["url"].(string)
+		if url == "" {
+			return nil
+		}
+		detail, _ := imageURL["detail"].(string)
+		return &ImageURL{Url: url, Detail: detail}
+	}
+	return nil
+}
+
+// HasImage 消息中是否包含图片
+func (m Message) HasImage() bool {
+	for _, content := range m.ParseContent() {
+		if content.Type == ContentTypeImageURL {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAudio 消息中是否包含音频输入
+func (m Message) HasAudio() bool {
+	for _, content := range m.ParseContent() {
+		if content.Type == ContentTypeInputAudio {
+			return true
+		}
+	}
+	return false
+}
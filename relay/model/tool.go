@@ -0,0 +1,29 @@
+package model
+
+// https://platform.openai.com/docs/guides/function-calling
+
+// Tool 请求中的工具定义，目前只有 function 一种类型
+type Tool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+type Function struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"` //JSON Schema
+	Strict      *bool  `json:"strict,omitempty"`
+}
+
+// ToolCall 模型返回的工具调用，流式响应中通过 Index 区分同一个调用的多个增量
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	Id       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"` //JSON 字符串，流式响应中分多次返回
+}
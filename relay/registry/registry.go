@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xiaoxiongmao5/we-api/common/config"
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/relay/timeout"
+)
+
+// 模型能力
+const (
+	CapabilityChat   = "chat"
+	CapabilityStream = "stream"
+	CapabilityVision = "vision"
+	CapabilityTools  = "tools"
+	CapabilityAudio  = "audio"
+	// 向量模型需要单独声明，默认能力中不包含
+	CapabilityEmbedding     = "embedding"
+	CapabilityImage         = "image"
+	CapabilitySpeech        = "speech"        //语音合成
+	CapabilityTranscription = "transcription" //语音转写和翻译
+	CapabilityResponses     = "responses"     //上游支持 /v1/responses，请求直接透传
+	CapabilityCompletions   = "completions"   //上游支持 /v1/completions，请求直接透传
+)
+
+type Model struct {
+	config.Model
+	capabilities map[string]bool
+}
+
+// Support 未配置 capabilities 时默认只支持 chat 和 stream
+func (m *Model) Support(capability string) bool {
+	if len(m.capabilities) == 0 {
+		return capability == CapabilityChat || capability == CapabilityStream
+	}
+	return m.capabilities[capability]
+}
+
+var (
+	mu     sync.RWMutex
+	models []*Model
+	// 模型名和别名 -> 模型
+	index map[string]*Model
+)
+
+func Init(modelConfigs []config.Model) error {
+	newModels := make([]*Model, 0, len(modelConfigs))
+	newIndex := make(map[string]*Model, len(modelConfigs))
+	now := time.Now().Unix()
+
+	for _, modelConfig := range modelConfigs {
+		if modelConfig.Name == "" {
+			return fmt.Errorf("model name is empty")
+		}
+		if !apitype.IsValid(modelConfig.Type) {
+			return fmt.Errorf("model %s: unknown type %q", modelConfig.Name, modelConfig.Type)
+		}
+		if r := modelConfig.Retry; r != nil && (r.MaxAttempts < 0 || r.BaseDelay < 0 || r.MaxDelay < 0) {
+			return fmt.Errorf("model %s: retry settings must not be negative", modelConfig.Name)
+		}
+		if modelConfig.Timeout < 0 {
+			return fmt.Errorf("model %s: timeout must not be negative", modelConfig.Name)
+		}
+		if !timeout.Valid(modelConfig.Timeouts) {
+			return fmt.Errorf("model %s: timeouts must not be negative", modelConfig.Name)
+		}
+		if modelConfig.UpstreamModel == "" {
+			modelConfig.UpstreamModel = modelConfig.Name
+		}
+		if modelConfig.OwnedBy == "" {
+			modelConfig.OwnedBy = apitype.OwnedBy[modelConfig.Type]
+		}
+		if modelConfig.Created == 0 {
+			modelConfig.Created = now
+		}
+
+		m := &Model{
+			Model:        modelConfig,
+			capabilities: make(map[string]bool, len(modelConfig.Capabilities)),
+		}
+		for _, capability := range modelConfig.Capabilities {
+			m.capabilities[capability] = true
+		}
+
+		for _, name := range append([]string{modelConfig.Name}, modelConfig.Aliases...) {
+			if _, ok := newIndex[name]; ok {
+				return fmt.Errorf("model name %s is duplicated", name)
+			}
+			newIndex[name] = m
+		}
+		newModels = append(newModels, m)
+	}
+
+	mu.Lock()
+	models = newModels
+	index = newIndex
+	mu.Unlock()
+
+	return nil
+}
+
+// Resolve 通过模型名或别名查找模型
+func Resolve(name string) (*Model, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	m, ok := index[name]
+	return m, ok
+}
+
+func Models() []*Model {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return models
+}
@@ -0,0 +1,38 @@
+package relaymode
+
+import "strings"
+
+// 请求的接口类型，适配器根据它决定上游地址和请求格式
+const (
+	Unknown            = ""
+	ChatCompletions    = "chat_completions"
+	Embeddings         = "embeddings"
+	ImagesGenerations  = "images_generations"
+	AudioSpeech        = "audio_speech"
+	AudioTranscription = "audio_transcription"
+	AudioTranslation   = "audio_translation"
+	Responses          = "responses"
+	Completions        = "completions"
+)
+
+func GetByPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/v1/chat/completions"):
+		return ChatCompletions
+	case strings.HasPrefix(path, "/v1/embeddings"):
+		return Embeddings
+	case strings.HasPrefix(path, "/v1/images/generations"):
+		return ImagesGenerations
+	case strings.HasPrefix(path, "/v1/audio/speech"):
+		return AudioSpeech
+	case strings.HasPrefix(path, "/v1/audio/transcriptions"):
+		return AudioTranscription
+	case strings.HasPrefix(path, "/v1/audio/translations"):
+		return AudioTranslation
+	case strings.HasPrefix(path, "/v1/responses"):
+		return Responses
+	case strings.HasPrefix(path, "/v1/completions"):
+		return Completions
+	}
+	return Unknown
+}
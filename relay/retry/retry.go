@@ -0,0 +1,109 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xiaoxiongmao5/we-api/common/config"
+	"github.com/xiaoxiongmao5/we-api/relay/registry"
+)
+
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var settings = Policy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+func Init(retry config.Retry) error {
+	if retry.MaxAttempts < 0 || retry.BaseDelay < 0 || retry.MaxDelay < 0 {
+		return errors.New("retry settings must not be negative")
+	}
+	settings = settings.merge(&retry)
+	return nil
+}
+
+// For 返回模型的重试策略，模型没有配置的字段使用全局配置
+func For(m *registry.Model) Policy {
+	if m == nil || m.Retry == nil {
+		return settings
+	}
+	return settings.merge(m.Retry)
+}
+
+func (p Policy) merge(retry *config.Retry) Policy {
+	if retry.MaxAttempts > 0 {
+		p.MaxAttempts = retry.MaxAttempts
+	}
+	if retry.BaseDelay > 0 {
+		p.BaseDelay = time.Duration(retry.BaseDelay) * time.Millisecond
+	}
+	if retry.MaxDelay > 0 {
+		p.MaxDelay = time.Duration(retry.MaxDelay) * time.Millisecond
+	}
+	return p
+}
+
+// Retryable 限流、超时和上游的 5xx 换一个渠道或 key 后可能成功，其它错误重试也没有意义
+func Retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout || statusCode >= http.StatusInternalServerError
+}
+
+// Delay 第 attempt 次请求（从 1 开始）失败后下次请求前的等待时间，返回 false 时不再重试。
+// reuse 为 true 表示下次请求仍然使用同一个渠道和 key，此时上游返回了 Retry-After 就按它等待，超过 MaxDelay 时不再重试；
+// 其它情况按指数退避并加上随机抖动，避免大量请求同时重试
+func (p Policy) Delay(attempt int, resp *http.Response, reuse bool) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if reuse && resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return retryAfter, retryAfter <= p.MaxDelay
+		}
+	}
+
+	delay := p.MaxDelay
+	if shift := attempt - 1; shift < 30 && p.BaseDelay<<shift < p.MaxDelay {
+		delay = p.BaseDelay << shift
+	}
+	// 在 [delay/2, delay] 之间随机
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)), true
+}
+
+// parseRetryAfter Retry-After 可以是秒数或者 HTTP 日期
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// Wait 等待 d，调用方断开连接时提前返回
+func Wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
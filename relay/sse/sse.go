@@ -0,0 +1,69 @@
+package sse
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+const dataPrefix = "data:"
+
+// event 各服务商流式事件中用于判断是否带有生成内容的字段
+type event struct {
+	Type    string `json:"type"` //Claude 和 Responses API 的事件类型
+	Choices []struct {
+		Text  string `json:"text"` //文本补全接口
+		Delta struct {
+			Content          any               `json:"content"`
+			ReasoningContent string            `json:"reasoning_content"`
+			ToolCalls        []json.RawMessage `json:"tool_calls"`
+			Audio            json.RawMessage   `json:"audio"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Candidates []struct {
+		Content struct {
+			Parts []json.RawMessage `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+}
+
+// Content 判断 SSE 的一行是否是带有生成内容的 data 事件，用于计算首 token。
+// 注释形式的心跳、只有角色的第一块、message_start 等元数据事件和 [DONE] 都不算
+func Content(line []byte) bool {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte(dataPrefix))
+	if !ok {
+		return false
+	}
+	var e event
+	if json.Unmarshal(bytes.TrimSpace(data), &e) != nil {
+		return false
+	}
+	if e.Type == "content_block_delta" || strings.HasSuffix(e.Type, ".delta") {
+		return true
+	}
+	for _, choice := range e.Choices {
+		if choice.Text != "" || choice.Delta.ReasoningContent != "" || len(choice.Delta.ToolCalls) > 0 || present(choice.Delta.Audio) {
+			return true
+		}
+		switch content := choice.Delta.Content.(type) {
+		case string:
+			if content != "" {
+				return true
+			}
+		case []any:
+			if len(content) > 0 {
+				return true
+			}
+		}
+	}
+	for _, candidate := range e.Candidates {
+		if len(candidate.Content.Parts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func present(raw json.RawMessage) bool {
+	return len(raw) > 0 && !bytes.Equal(raw, []byte("null"))
+}
@@ -0,0 +1,208 @@
+package timeout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/xiaoxiongmao5/we-api/common/config"
+)
+
+// 请求上游的各个阶段
+const (
+	KindConnect    = "connect"     //建立连接
+	KindHeader     = "header"      //等待响应头
+	KindFirstToken = "first_token" //等待流式响应的第一个内容事件
+	KindIdle       = "idle"        //等待响应的下一块数据
+)
+
+// Timeouts 各阶段的超时时间，0 表示不限制
+type Timeouts struct {
+	Connect    time.Duration
+	Header     time.Duration
+	FirstToken time.Duration
+	Idle       time.Duration
+}
+
+var settings = Timeouts{
+	Connect: 10 * time.Second,
+	Idle:    2 * time.Minute,
+}
+
+func Init(cfg config.Timeouts) error {
+	if !Valid(&cfg) {
+		return errors.New("timeouts must not be negative")
+	}
+	settings = settings.merge(&cfg)
+	return nil
+}
+
+// Valid 超时时间不能为负数，未配置时返回 true
+func Valid(cfg *config.Timeouts) bool {
+	return cfg == nil || (cfg.Connect >= 0 && cfg.Header >= 0 && cfg.FirstToken >= 0 && cfg.Idle >= 0)
+}
+
+// For 返回请求使用的超时时间，渠道的配置优先于模型的配置，都没有配置的字段使用全局配置
+func For(model *config.Timeouts, channel *config.Timeouts) Timeouts {
+	t := settings
+	if model != nil {
+		t = t.merge(model)
+	}
+	if channel != nil {
+		t = t.merge(channel)
+	}
+	return t
+}
+
+func (t Timeouts) merge(cfg *config.Timeouts) Timeouts {
+	if cfg.Connect > 0 {
+		t.Connect = time.Duration(cfg.Connect) * time.Millisecond
+	}
+	if cfg.Header > 0 {
+		t.Header = time.Duration(cfg.Header) * time.Millisecond
+	}
+	if cfg.FirstToken > 0 {
+		t.FirstToken = time.Duration(cfg.FirstToken) * time.Millisecond
+	}
+	if cfg.Idle > 0 {
+		t.Idle = time.Duration(cfg.Idle) * time.Millisecond
+	}
+	return t
+}
+
+// Error 上游请求在某个阶段超时
+type Error struct {
+	Kind  string
+	After time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("upstream %s timeout after %s", e.Kind, e.After)
+}
+
+// Timeout 与标准库超时错误的判断方式一致
+func (e *Error) Timeout() bool {
+	return true
+}
+
+// Watch 监控一次上游请求，某个阶段超时时取消请求，请求和读取响应返回的错误转换为 *Error
+type Watch struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	t      Timeouts
+
+	mu         sync.Mutex
+	timer      *time.Timer
+	firstToken *time.Timer
+	stopped    bool
+}
+
+// Start 开始监控，请求需要使用返回的 context。stream 为 true 时按流式请求计算首 token 超时
+func Start(parent context.Context, t Timeouts, stream bool) (context.Context, *Watch) {
+	ctx, cancel := context.WithCancelCause(parent)
+	w := &Watch{ctx: ctx, cancel: cancel, t: t}
+	if stream && t.FirstToken > 0 {
+		w.firstToken = time.AfterFunc(t.FirstToken, w.expire(KindFirstToken, t.FirstToken))
+	}
+	trace := &httptrace.ClientTrace{
+		GetConn:              func(string) { w.arm(KindConnect, t.Connect) },
+		GotConn:              func(httptrace.GotConnInfo) { w.disarm() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { w.arm(KindHeader, t.Header) },
+		GotFirstResponseByte: func() { w.disarm() },
+	}
+	return httptrace.WithClientTrace(ctx, trace), w
+}
+
+func (w *Watch) expire(kind string, after time.Duration) func() {
+	return func() {
+		w.cancel(&Error{Kind: kind, After: after})
+	}
+}
+
+// arm 开始计时，同一时间只有一个阶段在计时，首 token 单独计时
+func (w *Watch) arm(kind string, after time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if after > 0 && !w.stopped {
+		w.timer = time.AfterFunc(after, w.expire(kind, after))
+	}
+}
+
+func (w *Watch) disarm() {
+	w.arm("", 0)
+}
+
+// GotFirstToken 收到第一个带有生成内容的事件后停止首 token 计时，之后按数据间隔计时
+func (w *Watch) GotFirstToken() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.firstToken != nil {
+		w.firstToken.Stop()
+		w.firstToken = nil
+	}
+}
+
+func (w *Watch) waitingFirstToken() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.firstToken != nil
+}
+
+// Err 请求因为超时被取消时返回 *Error，否则原样返回
+func (w *Watch) Err(err error) error {
+	if err == nil {
+		return nil
+	}
+	var timeoutErr *Error
+	if errors.As(context.Cause(w.ctx), &timeoutErr) {
+		return timeoutErr
+	}
+	return err
+}
+
+// Stop 请求结束，停止计时并释放 context
+func (w *Watch) Stop() {
+	w.mu.Lock()
+	w.stopped = true
+	for _, timer := range []*time.Timer{w.timer, w.firstToken} {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	w.mu.Unlock()
+	w.cancel(context.Canceled)
+}
+
+// Body 包装响应体，读取时按首 token 和数据间隔计时，关闭时结束监控。
+// 心跳等不带内容的数据不会停止首 token 计时，由调用方判断后调用 GotFirstToken
+func (w *Watch) Body(body io.ReadCloser) io.ReadCloser {
+	return &watchedBody{ReadCloser: body, watch: w}
+}
+
+type watchedBody struct {
+	io.ReadCloser
+	watch *Watch
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	// 等待第一个带有内容的事件时由首 token 计时，之后按数据间隔计时
+	if !b.watch.waitingFirstToken() {
+		b.watch.arm(KindIdle, b.watch.t.Idle)
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.watch.disarm()
+	return n, b.watch.Err(err)
+}
+
+func (b *watchedBody) Close() error {
+	b.watch.Stop()
+	return b.ReadCloser.Close()
+}
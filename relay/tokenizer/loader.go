@@ -0,0 +1,49 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+//go:embed assets
+var assets embed.FS
+
+// embedLoader 从打包进二进制的词表文件加载，tiktoken 默认的 loader 会从网络下载
+type embedLoader struct{}
+
+func (l *embedLoader) LoadTiktokenBpe(tiktokenBpeFile string) (map[string]int, error) {
+	// tiktoken 传入的是词表的下载地址，只取文件名
+	contents, err := assets.ReadFile(path.Join("assets", path.Base(tiktokenBpeFile)))
+	if err != nil {
+		return nil, fmt.Errorf("bpe file %s is not embedded: %w", path.Base(tiktokenBpeFile), err)
+	}
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		token, rankStr, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid bpe line: %s", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, err
+		}
+		rank, err := strconv.Atoi(rankStr)
+		if err != nil {
+			return nil, err
+		}
+		ranks[string(decoded)] = rank
+	}
+	return ranks, scanner.Err()
+}
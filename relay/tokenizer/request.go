@@ -0,0 +1,148 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
+
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+)
+
+// https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+const (
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	// 每次回复都以 <|start|>assistant<|message|> 开头
+	tokensReplyPriming = 3
+	// 工具定义整体的额外开销
+	tokensPerTools = 12
+)
+
+// https://platform.openai.com/docs/guides/vision#calculating-costs
+const (
+	imageLowDetailTokens = 85
+	imageTileTokens      = 170
+	imageTileSize        = 512
+	// 无法离线获取尺寸的远程图片按 1024x1024 估算
+	defaultImageSize = 1024
+)
+
+// 音频无法离线解析时长，按常见码率由数据大小估算
+const AudioTokensPerSecond = 10 //每秒音频约 10 个 token
+
+var audioBytesPerSecond = map[string]int{
+	"wav":   32000, //16kHz 16bit 单声道
+	"pcm16": 48000, //24kHz 16bit 单声道
+	"mp3":   16000, //128kbps
+}
+
+// CountTokenRequest 计算请求的提示词 token 数，包括消息、图片和工具定义
+func CountTokenRequest(request *model.GeneralOpenAIRequest, modelName string) int {
+	tokens := CountTokenMessages(request.Messages, modelName)
+	if len(request.Tools) > 0 {
+		tools, _ := json.Marshal(request.Tools)
+		tokens += tokensPerTools + CountTokenText(string(tools), modelName)
+	}
+	if request.Functions != nil {
+		functions, _ := json.Marshal(request.Functions)
+		tokens += tokensPerTools + CountTokenText(string(functions), modelName)
+	}
+	return tokens
+}
+
+func CountTokenInput(input []string, modelName string) int {
+	tokens := 0
+	for _, text := range input {
+		tokens += CountTokenText(text, modelName)
+	}
+	return tokens
+}
+
+func CountTokenMessages(messages []model.Message, modelName string) int {
+	tokens := 0
+	for _, message := range messages {
+		tokens += tokensPerMessage
+		tokens += CountTokenText(message.Role, modelName)
+		for _, part := range message.ParseContent() {
+			switch part.Type {
+			case model.ContentTypeText:
+				tokens += CountTokenText(part.Text, modelName)
+			case model.ContentTypeImageURL:
+				if part.ImageURL != nil {
+					tokens += CountImageTokens(part.ImageURL.Url, part.ImageURL.Detail)
+				}
+			case model.ContentTypeInputAudio:
+				if part.InputAudio != nil {
+					tokens += CountAudioTokens(part.InputAudio.Data, part.InputAudio.Format)
+				}
+			}
+		}
+		if message.Name != nil {
+			tokens += tokensPerName + CountTokenText(*message.Name, modelName)
+		}
+		for _, toolCall := range message.ToolCalls {
+			tokens += CountTokenText(toolCall.Function.Name, modelName)
+			tokens += CountTokenText(toolCall.Function.Arguments, modelName)
+		}
+		if message.ToolCallId != "" {
+			tokens += CountTokenText(message.ToolCallId, modelName)
+		}
+	}
+	return tokens + tokensReplyPriming
+}
+
+// CountAudioTokens 按音频时长估算，每秒约 10 个 token
+func CountAudioTokens(data string, format string) int {
+	return CountAudioSizeTokens(base64.StdEncoding.DecodedLen(len(data)), format)
+}
+
+// CountAudioSizeTokens 按音频数据的字节数估算 token 数
+func CountAudioSizeTokens(size int, format string) int {
+	bytesPerSecond := audioBytesPerSecond[format]
+	if bytesPerSecond == 0 {
+		bytesPerSecond = audioBytesPerSecond["mp3"]
+	}
+	return int(math.Ceil(float64(size) / float64(bytesPerSecond) * AudioTokensPerSecond))
+}
+
+// CountImageTokens 按图片切成的 512x512 块数计算
+func CountImageTokens(url string, detail string) int {
+	if detail == "low" {
+		return imageLowDetailTokens
+	}
+
+	width, height := imageSize(url)
+	// 先等比缩放到 2048x2048 以内，再把短边缩放到 768
+	if width > 2048 || height > 2048 {
+		ratio := math.Min(2048/float64(width), 2048/float64(height))
+		width, height = int(float64(width)*ratio), int(float64(height)*ratio)
+	}
+	if shortest := min(width, height); shortest > 768 {
+		ratio := 768 / float64(shortest)
+		width, height = int(float64(width)*ratio), int(float64(height)*ratio)
+	}
+
+	tiles := int(math.Ceil(float64(width)/imageTileSize) * math.Ceil(float64(height)/imageTileSize))
+	return imageLowDetailTokens + imageTileTokens*tiles
+}
+
+// imageSize 只解析 data URI 中的图片尺寸，不发起网络请求
+func imageSize(url string) (int, int) {
+	if !strings.HasPrefix(url, "data:") {
+		return defaultImageSize, defaultImageSize
+	}
+	_, data, ok := strings.Cut(url, ",")
+	if !ok {
+		return defaultImageSize, defaultImageSize
+	}
+	config, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return defaultImageSize, defaultImageSize
+	}
+	return config.Width, config.Height
+}
@@ -0,0 +1,62 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+const (
+	EncodingCl100k = "cl100k_base"
+	EncodingO200k  = "o200k_base"
+)
+
+// 使用 o200k 的模型前缀，其余模型（包括 Claude 和 Gemini）都用 cl100k 近似
+var o200kModelPrefixes = []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "chatgpt-4o", "o1", "o3", "o4"}
+
+// 编码名 -> 词表，启动时由 Init 加载
+var encoders map[string]*tiktoken.Tiktoken
+
+func init() {
+	tiktoken.SetBpeLoader(&embedLoader{})
+}
+
+// Init 加载打包进二进制的词表，缺少词表时返回错误
+func Init() error {
+	loaded := make(map[string]*tiktoken.Tiktoken)
+	for _, name := range []string{EncodingCl100k, EncodingO200k} {
+		encoder, err := tiktoken.GetEncoding(name)
+		if err != nil {
+			return fmt.Errorf("load encoding %s failed: %w", name, err)
+		}
+		loaded[name] = encoder
+	}
+	encoders = loaded
+	return nil
+}
+
+func encodingName(modelName string) string {
+	for _, prefix := range o200kModelPrefixes {
+		if strings.HasPrefix(modelName, prefix) {
+			return EncodingO200k
+		}
+	}
+	return EncodingCl100k
+}
+
+func getEncoder(modelName string) *tiktoken.Tiktoken {
+	return encoders[encodingName(modelName)]
+}
+
+// CountTokenText 计算文本的 token 数，词表没有加载时平均每 4 个字符算 1 个 token
+func CountTokenText(text string, modelName string) int {
+	if text == "" {
+		return 0
+	}
+	if encoder := getEncoder(modelName); encoder != nil {
+		return len(encoder.Encode(text, nil, nil))
+	}
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
@@ -0,0 +1,62 @@
+package anthropic
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+)
+
+type Adaptor struct {
+}
+
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	return meta.BaseURL + "/v1/messages", nil
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	req.Header.Set("x-api-key", meta.APIKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	if meta.IsStream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, meta *meta.Meta, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if meta.Mode == relaymode.Embeddings {
+		return nil, errors.New("claude does not support embeddings")
+	}
+
+	return ConvertRequest(c.Request.Context(), *request)
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	return nil, errors.New("claude does not support image generation")
+}
+
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, request *model.AudioRequest) (io.Reader, error) {
+	return nil, errors.New("claude does not support audio transcription")
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrorHandler(resp)
+	}
+
+	if meta.IsStream {
+		err, usage = StreamHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	} else {
+		err, usage = Handler(c, resp, meta.ActualModelName)
+	}
+
+	return
+}
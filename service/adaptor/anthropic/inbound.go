@@ -0,0 +1,254 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+// 以下是 /v1/messages 入站请求的转换：Claude 格式的请求转成 OpenAI 格式转发给任意上游，响应再转回 Claude 格式
+
+func stopReasonOpenAI2Claude(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+// toolChoiceClaude2OpenAI tool_choice 的 type 为 auto any tool none
+func toolChoiceClaude2OpenAI(toolChoice *ToolChoice) any {
+	if toolChoice == nil {
+		return nil
+	}
+	switch toolChoice.Type {
+	case "any":
+		return "required"
+	case "tool":
+		return map[string]any{
+			"type":     model.ToolTypeFunction,
+			"function": map[string]any{"name": toolChoice.Name},
+		}
+	default:
+		return toolChoice.Type
+	}
+}
+
+// systemText system 可以是字符串或者 text 内容块的数组
+func systemText(system any) string {
+	switch v := system.(type) {
+	case string:
+		return v
+	case []any:
+		var texts []string
+		for _, item := range v {
+			if block, ok := item.(map[string]any); ok {
+				if text, ok := block["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// toolResultText tool_result 的 content 可以是字符串或者内容块的数组，只保留文本
+func toolResultText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var texts []string
+		for _, item := range v {
+			if block, ok := item.(map[string]any); ok && block["type"] == "text" {
+				if text, ok := block["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// imageURL 把 Claude 的图片来源转成 image_url 可以使用的地址
+func imageURL(source *ImageSource) string {
+	if source == nil {
+		return ""
+	}
+	if source.Type == "url" {
+		return source.Url
+	}
+	return fmt.Sprintf("data:%s;base64,%s", source.MediaType, source.Data)
+}
+
+// RequestClaude2OpenAI 转换 /v1/messages 的请求，多模态内容使用 ParseContent 能解析的 []any 结构
+func RequestClaude2OpenAI(claudeRequest *Request) *model.GeneralOpenAIRequest {
+	textRequest := model.GeneralOpenAIRequest{
+		Model:       claudeRequest.Model,
+		MaxTokens:   claudeRequest.MaxTokens,
+		Stream:      claudeRequest.Stream,
+		Temperature: claudeRequest.Temperature,
+		TopP:        claudeRequest.TopP,
+		TopK:        claudeRequest.TopK,
+	}
+	if len(claudeRequest.StopSequences) > 0 {
+		textRequest.Stop = claudeRequest.StopSequences
+	}
+
+	for _, tool := range claudeRequest.Tools {
+		textRequest.Tools = append(textRequest.Tools, model.Tool{
+			Type: model.ToolTypeFunction,
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	textRequest.ToolChoice = toolChoiceClaude2OpenAI(claudeRequest.ToolChoice)
+	if claudeRequest.ToolChoice != nil && claudeRequest.ToolChoice.DisableParallelToolUse {
+		parallelToolCalls := false
+		textRequest.ParallelTooCalls = &parallelToolCalls
+	}
+
+	if system := systemText(claudeRequest.System); system != "" {
+		textRequest.Messages = append(textRequest.Messages, model.Message{
+			Role:    model.RoleSystem,
+			Content: system,
+		})
+	}
+
+	for _, message := range claudeRequest.Messages {
+		var (
+			parts     []any
+			texts     []string
+			toolCalls []model.ToolCall
+			onlyText  = true
+		)
+		for _, content := range message.Content {
+			switch content.Type {
+			case "text":
+				texts = append(texts, content.Text)
+				parts = append(parts, map[string]any{"type": model.ContentTypeText, "text": content.Text})
+			case "image":
+				onlyText = false
+				parts = append(parts, map[string]any{
+					"type":      model.ContentTypeImageURL,
+					"image_url": map[string]any{"url": imageURL(content.Source)},
+				})
+			case "tool_use":
+				arguments, _ := json.Marshal(content.Input)
+				toolCalls = append(toolCalls, model.ToolCall{
+					Id:   content.Id,
+					Type: model.ToolTypeFunction,
+					Function: model.FunctionCall{
+						Name:      content.Name,
+						Arguments: string(arguments),
+					},
+				})
+			case "tool_result":
+				// 工具结果在 OpenAI 中是单独的 tool 消息，需要放在同一轮的其它内容之前
+				textRequest.Messages = append(textRequest.Messages, model.Message{
+					Role:       model.RoleTool,
+					ToolCallId: content.ToolUseId,
+					Content:    toolResultText(content.Content),
+				})
+			}
+		}
+		if len(parts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+
+		openaiMessage := model.Message{
+			Role:      message.Role,
+			ToolCalls: toolCalls,
+		}
+		switch {
+		case !onlyText:
+			openaiMessage.Content = parts
+		case len(texts) > 0:
+			openaiMessage.Content = strings.Join(texts, "\n")
+		}
+		textRequest.Messages = append(textRequest.Messages, openaiMessage)
+	}
+
+	return &textRequest
+}
+
+func usageOpenAI2Claude(usage *model.Usage) Usage {
+	if usage == nil {
+		return Usage{}
+	}
+	return Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	}
+}
+
+// ResponseOpenAI2Claude 只转换第一个候选结果，Claude 不支持多个候选
+func ResponseOpenAI2Claude(textResponse *openai.TextResponse, modelName string) *Response {
+	claudeResponse := Response{
+		Id:      "msg_" + strings.TrimPrefix(textResponse.Id, "chatcmpl-"),
+		Type:    "message",
+		Role:    model.RoleAssistant,
+		Content: []Content{},
+		Model:   modelName,
+		Usage:   usageOpenAI2Claude(&textResponse.Usage),
+	}
+	if len(textResponse.Choices) == 0 {
+		stopReason := "end_turn"
+		claudeResponse.StopReason = &stopReason
+		return &claudeResponse
+	}
+
+	choice := textResponse.Choices[0]
+	if text := choice.Message.StringContent(); text != "" {
+		claudeResponse.Content = append(claudeResponse.Content, Content{Type: "text", Text: text})
+	}
+	for _, toolCall := range choice.Message.ToolCalls {
+		claudeResponse.Content = append(claudeResponse.Content, Content{
+			Type:  "tool_use",
+			Id:    toolCall.Id,
+			Name:  toolCall.Function.Name,
+			Input: parseArguments(toolCall.Function.Arguments),
+		})
+	}
+	stopReason := stopReasonOpenAI2Claude(choice.FinishReason)
+	claudeResponse.StopReason = &stopReason
+	return &claudeResponse
+}
+
+// errorTypes HTTP 状态码对应的 Claude 错误类型
+var errorTypes = map[int]string{
+	http.StatusBadRequest:            "invalid_request_error",
+	http.StatusUnauthorized:          "authentication_error",
+	http.StatusForbidden:             "permission_error",
+	http.StatusNotFound:              "not_found_error",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusTooManyRequests:       "rate_limit_error",
+	529:                              "overloaded_error",
+}
+
+// ErrorOpenAI2Claude 转换网关内部的错误
+func ErrorOpenAI2Claude(err *model.ErrorWithStatusCode) *ErrorResponse {
+	errorType, ok := errorTypes[err.StatusCode]
+	if !ok {
+		errorType = "api_error"
+	}
+	return &ErrorResponse{
+		Type: "error",
+		Error: Error{
+			Type:    errorType,
+			Message: err.Message,
+		},
+	}
+}
@@ -0,0 +1,477 @@
+package anthropic
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common"
+	"github.com/xiaoxiongmao5/we-api/common/media"
+	"github.com/xiaoxiongmao5/we-api/common/render"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/tokenizer"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+const (
+	dataPrefix      = "data:"
+	defaultMaxToken = 4096
+)
+
+func stopReasonClaude2OpenAI(reason *string) string {
+	if reason == nil {
+		return ""
+	}
+	switch *reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return *reason
+	}
+}
+
+// toolChoiceOpenAI2Claude tool_choice 可以是 none auto required 或者指定函数的对象
+func toolChoiceOpenAI2Claude(toolChoice any) *ToolChoice {
+	switch v := toolChoice.(type) {
+	case string:
+		switch v {
+		case "none":
+			return &ToolChoice{Type: "none"}
+		case "required":
+			return &ToolChoice{Type: "any"}
+		case "auto":
+			return &ToolChoice{Type: "auto"}
+		}
+	case map[string]any:
+		if function, ok := v["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok {
+				return &ToolChoice{Type: "tool", Name: name}
+			}
+		}
+	}
+	return nil
+}
+
+// parseArguments 工具调用的参数是 JSON 字符串，Claude 需要的是对象
+func parseArguments(arguments string) any {
+	var input map[string]any
+	if err := json.Unmarshal([]byte(arguments), &input); err != nil || input == nil {
+		return map[string]any{}
+	}
+	return input
+}
+
+// Claude 支持的图片格式
+var supportedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func ConvertRequest(ctx context.Context, textRequest model.GeneralOpenAIRequest) (*Request, error) {
+	if textRequest.HasAudioOutput() {
+		return nil, errors.New("claude does not support audio output")
+	}
+	claudeRequest := Request{
+		Model:         textRequest.Model,
+		MaxTokens:     textRequest.MaxTokens,
+		StopSequences: textRequest.ParseStop(),
+		Stream:        textRequest.Stream,
+		Temperature:   textRequest.Temperature,
+		TopP:          textRequest.TopP,
+		TopK:          textRequest.TopK,
+	}
+	if claudeRequest.MaxTokens == 0 && textRequest.MaxCompletionTokens != nil {
+		claudeRequest.MaxTokens = *textRequest.MaxCompletionTokens
+	}
+	// Claude 的 max_tokens 是必填参数
+	if claudeRequest.MaxTokens == 0 {
+		claudeRequest.MaxTokens = defaultMaxToken
+	}
+
+	for _, tool := range textRequest.Tools {
+		inputSchema := tool.Function.Parameters
+		if inputSchema == nil {
+			inputSchema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		claudeRequest.Tools = append(claudeRequest.Tools, Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: inputSchema,
+		})
+	}
+	if len(claudeRequest.Tools) > 0 {
+		claudeRequest.ToolChoice = toolChoiceOpenAI2Claude(textRequest.ToolChoice)
+		if textRequest.ParallelTooCalls != nil && !*textRequest.ParallelTooCalls {
+			if claudeRequest.ToolChoice == nil {
+				claudeRequest.ToolChoice = &ToolChoice{Type: "auto"}
+			}
+			claudeRequest.ToolChoice.DisableParallelToolUse = true
+		}
+	}
+
+	var systems []string
+	for _, message := range textRequest.Messages {
+		// system 消息放到顶层的 system 字段
+		if message.Role == model.RoleSystem || message.Role == model.RoleDeveloper {
+			systems = append(systems, message.StringContent())
+			continue
+		}
+
+		var contents []Content
+		if message.Role == model.RoleTool {
+			// 工具的执行结果作为 user 消息中的 tool_result 返回给 Claude
+			contents = append(contents, Content{
+				Type:      "tool_result",
+				ToolUseId: message.ToolCallId,
+				Content:   message.StringContent(),
+			})
+		} else {
+			for _, part := range message.ParseContent() {
+				switch part.Type {
+				case model.ContentTypeText:
+					if part.Text == "" {
+						continue
+					}
+					contents = append(contents, Content{
+						Type: "text",
+						Text: part.Text,
+					})
+				case model.ContentTypeInputAudio:
+					return nil, errors.New("claude does not support audio input")
+				case model.ContentTypeImageURL:
+					// 图片统一转成 base64 传给 Claude
+					mimeType, data, err := media.GetImage(ctx, part.ImageURL.Url)
+					if err != nil {
+						return nil, err
+					}
+					if !supportedImageTypes[mimeType] {
+						return nil, fmt.Errorf("unsupported image type: %s", mimeType)
+					}
+					contents = append(contents, Content{
+						Type: "image",
+						Source: &ImageSource{
+							Type:      "base64",
+							MediaType: mimeType,
+							Data:      data,
+						},
+					})
+				}
+			}
+			for _, toolCall := range message.ToolCalls {
+				contents = append(contents, Content{
+					Type:  "tool_use",
+					Id:    toolCall.Id,
+					Name:  toolCall.Function.Name,
+					Input: parseArguments(toolCall.Function.Arguments),
+				})
+			}
+		}
+		if len(contents) == 0 {
+			continue
+		}
+
+		role := message.Role
+		if role != model.RoleAssistant {
+			role = model.RoleUser
+		}
+		// Claude 要求 user/assistant 交替出现，相邻的同角色消息合并为一条
+		if n := len(claudeRequest.Messages); n > 0 && claudeRequest.Messages[n-1].Role == role {
+			claudeRequest.Messages[n-1].Content = append(claudeRequest.Messages[n-1].Content, contents...)
+			continue
+		}
+		claudeRequest.Messages = append(claudeRequest.Messages, Message{
+			Role:    role,
+			Content: contents,
+		})
+	}
+	if len(systems) > 0 {
+		claudeRequest.System = strings.Join(systems, "\n")
+	}
+
+	return &claudeRequest, nil
+}
+
+func ResponseClaude2OpenAI(claudeResponse *Response) *openai.TextResponse {
+	var responseText string
+	var toolCalls []model.ToolCall
+	for _, content := range claudeResponse.Content {
+		switch content.Type {
+		case "text":
+			responseText += content.Text
+		case "tool_use":
+			arguments, _ := json.Marshal(content.Input)
+			toolCalls = append(toolCalls, model.ToolCall{
+				Id:   content.Id,
+				Type: model.ToolTypeFunction,
+				Function: model.FunctionCall{
+					Name:      content.Name,
+					Arguments: string(arguments),
+				},
+			})
+		}
+	}
+
+	choice := openai.TextResponseChoice{
+		Index: 0,
+		Message: model.Message{
+			Role:      model.RoleAssistant,
+			Content:   responseText,
+			ToolCalls: toolCalls,
+		},
+		FinishReason: stopReasonClaude2OpenAI(claudeResponse.StopReason),
+	}
+
+	return &openai.TextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", claudeResponse.Id),
+		Model:   claudeResponse.Model,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Choices: []openai.TextResponseChoice{choice},
+	}
+}
+
+func usageClaude2OpenAI(usage Usage) *model.Usage {
+	promptTokens := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return &model.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      promptTokens + usage.OutputTokens,
+	}
+}
+
+func StreamHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	common.SetEventStreamHeaders(c)
+
+	var (
+		id      string
+		created = time.Now().Unix()
+		usage   Usage
+		// 最终的 output_tokens 在 message_delta 中返回，中途断开时按已经输出的内容估算
+		responseText strings.Builder
+		gotUsage     bool
+		// Claude 内容块的 index -> OpenAI 工具调用的 index
+		toolIndexes = make(map[int]int)
+	)
+
+	newChunk := func() *openai.ChatCompletionsStreamResponse {
+		return &openai.ChatCompletionsStreamResponse{
+			Id:      fmt.Sprintf("chatcmpl-%s", id),
+			Model:   modelName,
+			Object:  "chat.completion.chunk",
+			Created: created,
+		}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		data := scanner.Text()
+		// 只处理 data 行，event 行的类型在 data 中也有
+		if !strings.HasPrefix(data, dataPrefix) {
+			continue
+		}
+		data = strings.TrimSpace(strings.TrimPrefix(data, dataPrefix))
+
+		var claudeResponse StreamResponse
+		if err := json.Unmarshal([]byte(data), &claudeResponse); err != nil {
+			continue
+		}
+
+		switch claudeResponse.Type {
+		case "message_start":
+			if claudeResponse.Message == nil {
+				continue
+			}
+			id = claudeResponse.Message.Id
+			if claudeResponse.Message.Model != "" {
+				modelName = claudeResponse.Message.Model
+			}
+			usage = claudeResponse.Message.Usage
+
+			chunk := newChunk()
+			chunk.Choices = []openai.ChatCompletionsStreamResponseChoice{{
+				Message: model.Message{Role: "assistant", Content: ""},
+			}}
+			render.ObjectData(c, chunk)
+		case "content_block_start":
+			block := claudeResponse.ContentBlock
+			if block == nil {
+				continue
+			}
+			var delta model.Message
+			switch {
+			case block.Type == "tool_use":
+				// 工具调用开始时先返回 id 和函数名，参数随后通过 input_json_delta 增量返回
+				toolIndex := len(toolIndexes)
+				toolIndexes[claudeResponse.Index] = toolIndex
+				responseText.WriteString(block.Name)
+				delta.ToolCalls = []model.ToolCall{{
+					Index: &toolIndex,
+					Id:    block.Id,
+					Type:  model.ToolTypeFunction,
+					Function: model.FunctionCall{
+						Name:      block.Name,
+						Arguments: "",
+					},
+				}}
+			case block.Text != "":
+				delta.Content = block.Text
+				responseText.WriteString(block.Text)
+			default:
+				continue
+			}
+			chunk := newChunk()
+			chunk.Choices = []openai.ChatCompletionsStreamResponseChoice{{Message: delta}}
+			render.ObjectData(c, chunk)
+		case "content_block_delta":
+			if claudeResponse.Delta == nil {
+				continue
+			}
+			var delta model.Message
+			switch claudeResponse.Delta.Type {
+			case "text_delta":
+				delta.Content = claudeResponse.Delta.Text
+				responseText.WriteString(claudeResponse.Delta.Text)
+			case "input_json_delta":
+				responseText.WriteString(claudeResponse.Delta.PartialJson)
+				toolIndex, ok := toolIndexes[claudeResponse.Index]
+				if !ok {
+					continue
+				}
+				delta.ToolCalls = []model.ToolCall{{
+					Index: &toolIndex,
+					Function: model.FunctionCall{
+						Arguments: claudeResponse.Delta.PartialJson,
+					},
+				}}
+			default:
+				continue
+			}
+			chunk := newChunk()
+			chunk.Choices = []openai.ChatCompletionsStreamResponseChoice{{Message: delta}}
+			render.ObjectData(c, chunk)
+		case "message_delta":
+			if claudeResponse.Usage != nil {
+				usage.OutputTokens = claudeResponse.Usage.OutputTokens
+				gotUsage = true
+			}
+			if claudeResponse.Delta == nil || claudeResponse.Delta.StopReason == nil {
+				continue
+			}
+			finishReason := stopReasonClaude2OpenAI(claudeResponse.Delta.StopReason)
+			chunk := newChunk()
+			chunk.Choices = []openai.ChatCompletionsStreamResponseChoice{{
+				Message:      model.Message{},
+				FinishReason: &finishReason,
+			}}
+			render.ObjectData(c, chunk)
+		case "error":
+			if claudeResponse.Error != nil {
+				render.ObjectData(c, gin.H{"error": claudeResponse.Error})
+			}
+		}
+	}
+
+	if !gotUsage {
+		usage.OutputTokens = max(usage.OutputTokens, tokenizer.CountTokenText(responseText.String(), modelName))
+	}
+	// 最后单独返回一个 usage 块，choices 为空数组，与 OpenAI include_usage 的格式一致
+	openaiUsage := usageClaude2OpenAI(usage)
+	if openaiUsage.PromptTokens == 0 {
+		openaiUsage.PromptTokens = promptTokens
+		openaiUsage.TotalTokens += promptTokens
+	}
+	chunk := newChunk()
+	chunk.Choices = []openai.ChatCompletionsStreamResponseChoice{}
+	chunk.Usage = openaiUsage
+	render.ObjectData(c, chunk)
+	render.Done(c)
+
+	// 调用方断开连接或者上游中断时，按已经输出的内容计费
+	if err := scanner.Err(); err != nil {
+		resp.Body.Close()
+		return openai.ErrorWrapper(err, "read_stream_failed", http.StatusInternalServerError), openaiUsage
+	}
+
+	err := resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), openaiUsage
+	}
+
+	return nil, openaiUsage
+}
+
+func Handler(c *gin.Context, resp *http.Response, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	var claudeResponse Response
+	err = json.Unmarshal(responseBody, &claudeResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	if claudeResponse.Error != nil && claudeResponse.Error.Type != "" {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: claudeResponse.Error.Message,
+				Type:    claudeResponse.Error.Type,
+				Code:    claudeResponse.Error.Type,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+
+	fullTextResponse := ResponseClaude2OpenAI(&claudeResponse)
+	if fullTextResponse.Model == "" {
+		fullTextResponse.Model = modelName
+	}
+	usage := usageClaude2OpenAI(claudeResponse.Usage)
+	fullTextResponse.Usage = *usage
+
+	c.JSON(http.StatusOK, fullTextResponse)
+
+	return nil, usage
+}
+
+func ErrorHandler(resp *http.Response) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	resp.Body.Close()
+
+	var claudeResponse Response
+	if err = json.Unmarshal(responseBody, &claudeResponse); err != nil || claudeResponse.Error == nil {
+		return openai.ErrorWrapper(fmt.Errorf("bad response status code %d: %s", resp.StatusCode, string(responseBody)), "bad_response_status_code", resp.StatusCode)
+	}
+
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: claudeResponse.Error.Message,
+			Type:    claudeResponse.Error.Type,
+			Code:    claudeResponse.Error.Type,
+		},
+		StatusCode: resp.StatusCode,
+	}
+}
@@ -0,0 +1,126 @@
+package anthropic
+
+import "encoding/json"
+
+// https://docs.anthropic.com/claude/reference/messages_post
+
+type ImageSource struct {
+	Type      string `json:"type"` //base64 url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+}
+
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// image
+	Source *ImageSource `json:"source,omitempty"`
+	// tool_use
+	Id    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Input any    `json:"input,omitempty"`
+	// tool_result
+	ToolUseId string `json:"tool_use_id,omitempty"`
+	Content   any    `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+type Message struct {
+	Role    string    `json:"role"`
+	Content []Content `json:"content"`
+}
+
+// UnmarshalJSON 客户端发来的 content 可以是字符串，统一转成内容块
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	m.Role = raw.Role
+	m.Content = nil
+
+	var text string
+	if err := json.Unmarshal(raw.Content, &text); err == nil {
+		m.Content = []Content{{Type: "text", Text: text}}
+		return nil
+	}
+	return json.Unmarshal(raw.Content, &m.Content)
+}
+
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type ToolChoice struct {
+	Type                   string `json:"type"` //auto any tool none
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type Request struct {
+	Model         string      `json:"model"`
+	Messages      []Message   `json:"messages"`
+	System        any         `json:"system,omitempty"` //字符串或者 text 内容块的数组
+	MaxTokens     int         `json:"max_tokens,omitempty"`
+	StopSequences []string    `json:"stop_sequences,omitempty"`
+	Stream        bool        `json:"stream,omitempty"`
+	Temperature   *float64    `json:"temperature,omitempty"`
+	TopP          *float64    `json:"top_p,omitempty"`
+	TopK          int         `json:"top_k,omitempty"`
+	Tools         []Tool      `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice `json:"tool_choice,omitempty"`
+}
+
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type Response struct {
+	Id           string    `json:"id"`
+	Type         string    `json:"type"`
+	Role         string    `json:"role"`
+	Content      []Content `json:"content"`
+	Model        string    `json:"model"`
+	StopReason   *string   `json:"stop_reason"`
+	StopSequence *string   `json:"stop_sequence"`
+	Usage        Usage     `json:"usage"`
+	Error        *Error    `json:"error,omitempty"`
+}
+
+type ErrorResponse struct {
+	Type  string `json:"type"` //error
+	Error Error  `json:"error"`
+}
+
+type Delta struct {
+	Type         string  `json:"type"`
+	Text         string  `json:"text,omitempty"`
+	PartialJson  string  `json:"partial_json,omitempty"` //input_json_delta，工具调用参数的增量
+	StopReason   *string `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+}
+
+// SSE 事件: message_start content_block_start content_block_delta content_block_stop message_delta message_stop ping error
+type StreamResponse struct {
+	Type         string    `json:"type"`
+	Message      *Response `json:"message,omitempty"`
+	Index        int       `json:"index"`
+	ContentBlock *Content  `json:"content_block,omitempty"`
+	Delta        *Delta    `json:"delta,omitempty"`
+	Usage        *Usage    `json:"usage,omitempty"`
+	Error        *Error    `json:"error,omitempty"`
+}
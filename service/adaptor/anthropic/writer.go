@@ -0,0 +1,225 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+// ResponseWriter 把转发流程写出的 OpenAI 格式响应转换成 Claude 格式。
+// 非流式响应在 Finish 时整体转换；流式响应转换成 Claude 的 SSE 事件后立即写出
+type ResponseWriter struct {
+	*openai.TranscodeWriter
+	meta   *meta.Meta
+	stream bool
+
+	// 流式响应的状态
+	started    bool
+	done       bool //收到了上游的 [DONE]
+	id         string
+	textBlock  int //当前打开的文本块，-1 表示没有
+	nextIndex  int
+	toolBlocks map[int]int //OpenAI 工具调用的 index -> Claude 内容块的 index，上游可能交替返回多个工具调用的参数，工具块在结束时才关闭
+	stopReason string
+	usage      *model.Usage
+}
+
+func NewResponseWriter(c *gin.Context, meta *meta.Meta, stream bool) *ResponseWriter {
+	w := &ResponseWriter{
+		meta:       meta,
+		stream:     stream,
+		textBlock:  -1,
+		toolBlocks: make(map[int]int),
+	}
+	w.TranscodeWriter = openai.NewTranscodeWriter(c.Writer, stream, w.handleLine)
+	c.Writer = w
+	return w
+}
+
+// Finish 转发结束后调用，relayErr 为转发流程返回的错误
+func (w *ResponseWriter) Finish(relayErr *model.ErrorWithStatusCode) {
+	// 上游在 [DONE] 之后仍可能返回读取错误，结束事件等转发结果确定后再输出
+	if w.stream && w.started && relayErr != nil {
+		w.event("error", ErrorOpenAI2Claude(relayErr))
+		return
+	}
+	if w.stream && relayErr == nil && (w.started || w.done) {
+		w.finish()
+		return
+	}
+
+	if relayErr != nil {
+		w.writeJSON(relayErr.StatusCode, ErrorOpenAI2Claude(relayErr))
+		return
+	}
+
+	var textResponse openai.TextResponse
+	if err := json.Unmarshal(w.Body(), &textResponse); err != nil {
+		w.writeJSON(http.StatusInternalServerError, ErrorOpenAI2Claude(openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)))
+		return
+	}
+	w.writeJSON(http.StatusOK, ResponseOpenAI2Claude(&textResponse, w.meta.FullMode))
+}
+
+func (w *ResponseWriter) writeJSON(code int, v any) {
+	jsonData, _ := json.Marshal(v)
+	header := w.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(code)
+	w.ResponseWriter.Write(jsonData)
+}
+
+func (w *ResponseWriter) event(eventType string, v any) {
+	if !w.ResponseWriter.Written() {
+		w.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	jsonData, _ := json.Marshal(v)
+	fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", eventType, jsonData)
+	w.ResponseWriter.Flush()
+}
+
+func (w *ResponseWriter) handleLine(line string) {
+	if !strings.HasPrefix(line, dataPrefix) {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, dataPrefix))
+	if data == "[DONE]" {
+		w.done = true
+		return
+	}
+
+	var chunk openai.ChatCompletionsStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return
+	}
+	w.start(chunk.Id)
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		w.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			if w.textBlock < 0 {
+				w.textBlock = w.openBlock(map[string]any{"type": "text", "text": ""})
+			}
+			w.event("content_block_delta", map[string]any{
+				"type":  "content_block_delta",
+				"index": w.textBlock,
+				"delta": map[string]any{"type": "text_delta", "text": text},
+			})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			index := 0
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			blockIndex, ok := w.toolBlocks[index]
+			if !ok {
+				blockIndex = w.openBlock(map[string]any{
+					"type":  "tool_use",
+					"id":    toolCall.Id,
+					"name":  toolCall.Function.Name,
+					"input": map[string]any{},
+				})
+				w.toolBlocks[index] = blockIndex
+			}
+			if toolCall.Function.Arguments != "" {
+				w.event("content_block_delta", map[string]any{
+					"type":  "content_block_delta",
+					"index": blockIndex,
+					"delta": map[string]any{"type": "input_json_delta", "partial_json": toolCall.Function.Arguments},
+				})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.stopReason = stopReasonOpenAI2Claude(*choice.FinishReason)
+		}
+	}
+}
+
+func (w *ResponseWriter) start(id string) {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.id = "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+	w.event("message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":            w.id,
+			"type":          "message",
+			"role":          model.RoleAssistant,
+			"content":       []any{},
+			"model":         w.meta.FullMode,
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         Usage{InputTokens: w.meta.PromptTokens},
+		},
+	})
+}
+
+// openBlock 打开新的内容块前先关闭文本块，返回新内容块的 index
+func (w *ResponseWriter) openBlock(contentBlock map[string]any) int {
+	w.closeTextBlock()
+	index := w.nextIndex
+	w.nextIndex++
+	w.event("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         index,
+		"content_block": contentBlock,
+	})
+	return index
+}
+
+func (w *ResponseWriter) closeBlock(index int) {
+	w.event("content_block_stop", map[string]any{
+		"type":  "content_block_stop",
+		"index": index,
+	})
+}
+
+func (w *ResponseWriter) closeTextBlock() {
+	if w.textBlock < 0 {
+		return
+	}
+	w.closeBlock(w.textBlock)
+	w.textBlock = -1
+}
+
+// finish 上游的 usage 在 finish_reason 之后才返回，转发成功结束后再输出 message_delta
+func (w *ResponseWriter) finish() {
+	w.start("")
+	w.closeTextBlock()
+	blocks := make([]int, 0, len(w.toolBlocks))
+	for _, index := range w.toolBlocks {
+		blocks = append(blocks, index)
+	}
+	sort.Ints(blocks)
+	for _, index := range blocks {
+		w.closeBlock(index)
+	}
+	if w.stopReason == "" {
+		w.stopReason = "end_turn"
+	}
+	usage := Usage{InputTokens: w.meta.PromptTokens}
+	if w.usage != nil {
+		usage = usageOpenAI2Claude(w.usage)
+	}
+	w.event("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": w.stopReason, "stop_sequence": nil},
+		"usage": map[string]any{"input_tokens": usage.InputTokens, "output_tokens": usage.OutputTokens},
+	})
+	w.event("message_stop", map[string]any{"type": "message_stop"})
+}
@@ -1,6 +1,8 @@
 package adaptor
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -8,6 +10,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/sse"
+	"github.com/xiaoxiongmao5/we-api/relay/timeout"
 	"github.com/xiaoxiongmao5/we-api/utils"
 	"github.com/xiaoxiongmao5/we-api/xlog"
 	"github.com/xiaoxiongmao5/we-api/xnet/xresty/xhttp"
@@ -26,8 +30,11 @@ func DoRequest(c *gin.Context, a Adaptor, meta *meta.Meta, requestBody io.Reader
 		xlog.String("fullRequestURL", fullRequestURL),
 		xlog.String("method", c.Request.Method))
 
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	// 调用方断开连接或者超时时，上游请求随之取消；各阶段超时时返回 *timeout.Error
+	reqCtx, watch := timeout.Start(ctx, meta.Timeouts, meta.IsStream)
+	req, err := http.NewRequestWithContext(reqCtx, c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
+		watch.Stop()
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
 
@@ -35,20 +42,57 @@ func DoRequest(c *gin.Context, a Adaptor, meta *meta.Meta, requestBody io.Reader
 
 	err = a.SetupRequestHeader(c, req, meta)
 	if err != nil {
+		watch.Stop()
 		return nil, fmt.Errorf("setup request failed: %w", err)
 	}
+	// 渠道的额外请求头优先级最高
+	for k, v := range meta.Headers {
+		req.Header.Set(k, v)
+	}
 
 	client := xhttp.NewClient()
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		watch.Stop()
+		return nil, watch.Err(err)
 	}
 	if resp == nil {
+		watch.Stop()
 		return nil, errors.New("resp is nil")
 	}
 
 	req.Body.Close()
 	c.Request.Body.Close()
 
+	// 响应体关闭时结束计时
+	resp.Body = watch.Body(resp.Body)
+	if meta.IsStream && resp.StatusCode == http.StatusOK && meta.Timeouts.FirstToken > 0 {
+		// 等到第一个带有生成内容的事件再返回，首 token 超时时调用方还可以换渠道重试。
+		// 心跳和 message_start 等元数据事件不算，已经读到的数据缓存下来原样交给适配器
+		reader := bufio.NewReader(resp.Body)
+		head := &bytes.Buffer{}
+		for {
+			line, err := reader.ReadBytes('\n')
+			head.Write(line)
+			if sse.Content(line) {
+				watch.GotFirstToken()
+				break
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+		}
+		resp.Body = readCloser{Reader: io.MultiReader(head, reader), Closer: resp.Body}
+	}
+
 	return resp, nil
 }
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,83 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+)
+
+type Adaptor struct {
+	encodingFormat string //向量请求的 encoding_format，转换响应时使用
+	responseFormat string //图片请求的 response_format，转换响应时使用
+}
+
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	action := "generateContent" //非流式传输
+	switch {
+	case meta.Mode == relaymode.Embeddings:
+		action = "batchEmbedContents"
+	case meta.Mode == relaymode.ImagesGenerations:
+		action = "predict"
+	case meta.IsStream:
+		action = "streamGenerateContent?alt=sse" //流式传输
+	}
+
+	return fmt.Sprintf("%s/v1beta/models/%s:%s", meta.BaseURL, meta.ActualModelName, action), nil
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	req.Header.Set("x-goog-api-key", meta.APIKey)
+
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, meta *meta.Meta, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+
+	switch meta.Mode {
+	case relaymode.Embeddings:
+		a.encodingFormat = request.EncodingFormat
+		return ConvertEmbeddingRequest(*request)
+	}
+	return ConvertRequest(c.Request.Context(), *request)
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+
+	a.responseFormat = request.ResponseFormat
+	return ConvertImageRequest(*request)
+}
+
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, request *model.AudioRequest) (io.Reader, error) {
+	return nil, errors.New("gemini does not support audio transcription")
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrorHandler(resp)
+	}
+
+	switch {
+	case meta.Mode == relaymode.ImagesGenerations:
+		err = ImageHandler(c, resp, a.responseFormat)
+	case meta.Mode == relaymode.Embeddings:
+		err, usage = EmbeddingHandler(c, resp, meta.ActualModelName, a.encodingFormat, meta.PromptTokens)
+	case meta.IsStream:
+		err, usage = StreamHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	default:
+		err, usage = Handler(c, resp, meta.ActualModelName)
+	}
+
+	return
+}
@@ -0,0 +1,69 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+// ConvertEmbeddingRequest 多条输入统一使用 batchEmbedContents，一条输入也是一个批次
+func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) (*BatchEmbeddingRequest, error) {
+	input := request.ParseInput()
+	if len(input) == 0 && request.InputTokens() > 0 {
+		return nil, errors.New("token array input is not supported")
+	}
+	if len(input) == 0 {
+		return nil, errors.New("input is empty")
+	}
+
+	batchRequest := BatchEmbeddingRequest{
+		Requests: make([]EmbeddingRequest, 0, len(input)),
+	}
+	for _, text := range input {
+		batchRequest.Requests = append(batchRequest.Requests, EmbeddingRequest{
+			Model: "models/" + request.Model,
+			Content: ChatContent{
+				Parts: []Part{{Text: text}},
+			},
+			OutputDimensionality: request.Dimensions,
+		})
+	}
+	return &batchRequest, nil
+}
+
+// EmbeddingHandler Gemini 的向量接口不返回 usage，按本地计算的 token 数计费
+func EmbeddingHandler(c *gin.Context, resp *http.Response, modelName string, encodingFormat string, promptTokens int) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	var batchResponse BatchEmbeddingResponse
+	err = json.Unmarshal(responseBody, &batchResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	embeddings := make([][]float64, 0, len(batchResponse.Embeddings))
+	for _, embedding := range batchResponse.Embeddings {
+		embeddings = append(embeddings, embedding.Values)
+	}
+	usage := model.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+
+	c.JSON(http.StatusOK, openai.NewEmbeddingResponse(embeddings, modelName, encodingFormat, usage))
+
+	return nil, &usage
+}
@@ -0,0 +1,83 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+// Imagen 只支持固定的宽高比，OpenAI 的尺寸按比例换算
+var sizeAspectRatios = map[string]string{
+	"256x256":   "1:1",
+	"512x512":   "1:1",
+	"1024x1024": "1:1",
+	"1792x1024": "16:9",
+	"1024x1792": "9:16",
+	"1536x1024": "4:3",
+	"1024x1536": "3:4",
+}
+
+func ConvertImageRequest(request model.ImageRequest) (*ImageRequest, error) {
+	if request.Prompt == "" {
+		return nil, errors.New("prompt is empty")
+	}
+
+	imageRequest := ImageRequest{
+		Instances: []ImageInstance{{Prompt: request.Prompt}},
+		Parameters: ImageParameters{
+			SampleCount: request.N,
+		},
+	}
+	if request.Size != "" {
+		aspectRatio, ok := sizeAspectRatios[request.Size]
+		if !ok {
+			return nil, fmt.Errorf("unsupported image size: %s", request.Size)
+		}
+		imageRequest.Parameters.AspectRatio = aspectRatio
+	}
+	return &imageRequest, nil
+}
+
+// ImageHandler Imagen 只返回 base64，要求 url 格式时返回 data URI
+func ImageHandler(c *gin.Context, resp *http.Response, responseFormat string) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+
+	var imageResponse ImageResponse
+	err = json.Unmarshal(responseBody, &imageResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+
+	fullImageResponse := openai.ImageResponse{
+		Created: time.Now().Unix(),
+		Data:    make([]openai.ImageData, 0, len(imageResponse.Predictions)),
+	}
+	for _, prediction := range imageResponse.Predictions {
+		if responseFormat == "b64_json" {
+			fullImageResponse.Data = append(fullImageResponse.Data, openai.ImageData{B64Json: prediction.BytesBase64Encoded})
+			continue
+		}
+		fullImageResponse.Data = append(fullImageResponse.Data, openai.ImageData{
+			Url: fmt.Sprintf("data:%s;base64,%s", prediction.MimeType, prediction.BytesBase64Encoded),
+		})
+	}
+
+	c.JSON(http.StatusOK, fullImageResponse)
+
+	return nil
+}
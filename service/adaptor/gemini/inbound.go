@@ -0,0 +1,330 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+// 以下是 /v1beta/models/{model}:generateContent 入站请求的转换：Gemini 格式的请求转成 OpenAI 格式转发给任意上游，响应再转回 Gemini 格式
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+// toolChoiceGemini2OpenAI functionCallingConfig 的 mode 为 AUTO ANY NONE
+func toolChoiceGemini2OpenAI(toolConfig *ToolConfig) any {
+	if toolConfig == nil {
+		return nil
+	}
+	config := toolConfig.FunctionCallingConfig
+	switch config.Mode {
+	case "NONE":
+		return "none"
+	case "ANY":
+		if len(config.AllowedFunctionNames) == 1 {
+			return map[string]any{
+				"type":     model.ToolTypeFunction,
+				"function": map[string]any{"name": config.AllowedFunctionNames[0]},
+			}
+		}
+		return "required"
+	case "AUTO":
+		return "auto"
+	}
+	return nil
+}
+
+// schemaGemini2OpenAI Gemini 的 schema 中 type 是大写的 OBJECT STRING ...，转成 JSON Schema 的小写
+func schemaGemini2OpenAI(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		converted := make(map[string]any, len(v))
+		for key, value := range v {
+			if typ, ok := value.(string); ok && key == "type" {
+				converted[key] = strings.ToLower(typ)
+				continue
+			}
+			converted[key] = schemaGemini2OpenAI(value)
+		}
+		return converted
+	case []any:
+		converted := make([]any, 0, len(v))
+		for _, item := range v {
+			converted = append(converted, schemaGemini2OpenAI(item))
+		}
+		return converted
+	}
+	return schema
+}
+
+// audioFormat input_audio 的 format 使用文件扩展名
+func audioFormat(mimeType string) string {
+	switch format := strings.TrimPrefix(mimeType, "audio/"); format {
+	case "mpeg", "mp3":
+		return "mp3"
+	case "wav", "x-wav", "wave":
+		return "wav"
+	default:
+		return format
+	}
+}
+
+// filePart 把 inlineData fileData 转成 OpenAI 的多模态内容，只支持图片和音频
+func filePart(part Part) (map[string]any, error) {
+	var mimeType, url, data string
+	if part.InlineData != nil {
+		mimeType = part.InlineData.MimeType
+		data = part.InlineData.Data
+		url = fmt.Sprintf("data:%s;base64,%s", mimeType, data)
+	} else {
+		mimeType = part.FileData.MimeType
+		url = part.FileData.FileUri
+	}
+
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return map[string]any{
+			"type":      model.ContentTypeImageURL,
+			"image_url": map[string]any{"url": url},
+		}, nil
+	case strings.HasPrefix(mimeType, "audio/") && part.InlineData != nil:
+		return map[string]any{
+			"type":        model.ContentTypeInputAudio,
+			"input_audio": map[string]any{"data": data, "format": audioFormat(mimeType)},
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported file mime type: %s", mimeType)
+}
+
+// RequestGemini2OpenAI 转换 generateContent 的请求，模型名来自请求路径
+func RequestGemini2OpenAI(geminiRequest *ChatRequest, modelName string, stream bool) (*model.GeneralOpenAIRequest, error) {
+	config := geminiRequest.GenerationConfig
+	textRequest := model.GeneralOpenAIRequest{
+		Model:            modelName,
+		Stream:           stream,
+		MaxTokens:        config.MaxOutputTokens,
+		N:                config.CandidateCount,
+		Temperature:      config.Temperature,
+		TopP:             config.TopP,
+		TopK:             config.TopK,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+		Seed:             float64(config.Seed),
+	}
+	if len(config.StopSequences) > 0 {
+		textRequest.Stop = config.StopSequences
+	}
+	if config.ResponseMimeType == "application/json" {
+		textRequest.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+		if schema, ok := schemaGemini2OpenAI(config.ResponseSchema).(map[string]any); ok {
+			textRequest.ResponseFormat = &model.ResponseFormat{
+				Type:       "json_schema",
+				JsonSchema: &model.JSONSchema{Name: "response", Schema: schema},
+			}
+		}
+	}
+
+	for _, tool := range geminiRequest.Tools {
+		for _, declaration := range tool.FunctionDeclarations {
+			textRequest.Tools = append(textRequest.Tools, model.Tool{
+				Type: model.ToolTypeFunction,
+				Function: model.Function{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  schemaGemini2OpenAI(declaration.Parameters),
+				},
+			})
+		}
+	}
+	textRequest.ToolChoice = toolChoiceGemini2OpenAI(geminiRequest.ToolConfig)
+
+	if geminiRequest.SystemInstruction != nil {
+		var texts []string
+		for _, part := range geminiRequest.SystemInstruction.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		if len(texts) > 0 {
+			textRequest.Messages = append(textRequest.Messages, model.Message{
+				Role:    model.RoleSystem,
+				Content: strings.Join(texts, "\n"),
+			})
+		}
+	}
+
+	// Gemini 的函数调用没有 id，按函数名依次匹配调用和结果
+	var callCount int
+	pendingCalls := make(map[string][]string)
+	for _, content := range geminiRequest.Contents {
+		var (
+			parts     []any
+			texts     []string
+			toolCalls []model.ToolCall
+			onlyText  = true
+		)
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				callCount++
+				id := fmt.Sprintf("call_%d", callCount)
+				pendingCalls[part.FunctionCall.Name] = append(pendingCalls[part.FunctionCall.Name], id)
+				arguments, _ := json.Marshal(part.FunctionCall.Args)
+				toolCalls = append(toolCalls, model.ToolCall{
+					Id:   id,
+					Type: model.ToolTypeFunction,
+					Function: model.FunctionCall{
+						Name:      part.FunctionCall.Name,
+						Arguments: string(arguments),
+					},
+				})
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				var id string
+				if ids := pendingCalls[name]; len(ids) > 0 {
+					id, pendingCalls[name] = ids[0], ids[1:]
+				} else {
+					callCount++
+					id = fmt.Sprintf("call_%d", callCount)
+				}
+				response, _ := json.Marshal(part.FunctionResponse.Response)
+				textRequest.Messages = append(textRequest.Messages, model.Message{
+					Role:       model.RoleTool,
+					ToolCallId: id,
+					Content:    string(response),
+				})
+			case part.InlineData != nil || part.FileData != nil:
+				onlyText = false
+				item, err := filePart(part)
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, item)
+			case part.Thought:
+				// 思考内容不回传给上游
+			case part.Text != "":
+				texts = append(texts, part.Text)
+				parts = append(parts, map[string]any{"type": model.ContentTypeText, "text": part.Text})
+			}
+		}
+		if len(parts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+
+		openaiMessage := model.Message{
+			Role:      model.RoleUser,
+			ToolCalls: toolCalls,
+		}
+		if content.Role == "model" {
+			openaiMessage.Role = model.RoleAssistant
+		}
+		switch {
+		case !onlyText:
+			openaiMessage.Content = parts
+		case len(texts) > 0:
+			openaiMessage.Content = strings.Join(texts, "\n")
+		}
+		textRequest.Messages = append(textRequest.Messages, openaiMessage)
+	}
+
+	return &textRequest, nil
+}
+
+func usageOpenAI2Gemini(usage *model.Usage) *UsageMetadata {
+	if usage == nil {
+		return nil
+	}
+	usageMetadata := UsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+	}
+	// Gemini 的 candidatesTokenCount 不包含思考消耗的 token
+	if usage.CompletionTokensDetails != nil && usage.CompletionTokensDetails.ReasoningTokens > 0 {
+		usageMetadata.ThoughtsTokenCount = usage.CompletionTokensDetails.ReasoningTokens
+		usageMetadata.CandidatesTokenCount -= usageMetadata.ThoughtsTokenCount
+	}
+	return &usageMetadata
+}
+
+// candidateParts 文本和工具调用转成 Gemini 的 parts，parts 不能为空
+func candidateParts(text string, toolCalls []model.ToolCall) []Part {
+	parts := make([]Part, 0, len(toolCalls)+1)
+	if text != "" {
+		parts = append(parts, Part{Text: text})
+	}
+	for _, toolCall := range toolCalls {
+		var args map[string]any
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil || args == nil {
+			args = map[string]any{}
+		}
+		parts = append(parts, Part{
+			FunctionCall: &FunctionCall{
+				Name: toolCall.Function.Name,
+				Args: args,
+			},
+		})
+	}
+	if len(parts) == 0 {
+		parts = append(parts, Part{})
+	}
+	return parts
+}
+
+func ResponseOpenAI2Gemini(textResponse *openai.TextResponse, modelName string) *ChatResponse {
+	geminiResponse := ChatResponse{
+		Candidates:    make([]ChatCandidate, 0, len(textResponse.Choices)),
+		UsageMetadata: usageOpenAI2Gemini(&textResponse.Usage),
+		ModelVersion:  modelName,
+	}
+	for _, choice := range textResponse.Choices {
+		geminiResponse.Candidates = append(geminiResponse.Candidates, ChatCandidate{
+			Content: ChatContent{
+				Role:  "model",
+				Parts: candidateParts(choice.Message.StringContent(), choice.Message.ToolCalls),
+			},
+			FinishReason: finishReasonOpenAI2Gemini(choice.FinishReason),
+			Index:        choice.Index,
+		})
+	}
+	return &geminiResponse
+}
+
+// errorStatus HTTP 状态码对应的 Gemini 错误状态
+var errorStatus = map[int]string{
+	http.StatusBadRequest:          "INVALID_ARGUMENT",
+	http.StatusUnauthorized:        "UNAUTHENTICATED",
+	http.StatusForbidden:           "PERMISSION_DENIED",
+	http.StatusNotFound:            "NOT_FOUND",
+	http.StatusTooManyRequests:     "RESOURCE_EXHAUSTED",
+	http.StatusServiceUnavailable:  "UNAVAILABLE",
+	http.StatusGatewayTimeout:      "DEADLINE_EXCEEDED",
+	http.StatusInternalServerError: "INTERNAL",
+}
+
+// ErrorOpenAI2Gemini 转换网关内部的错误
+func ErrorOpenAI2Gemini(err *model.ErrorWithStatusCode) *ErrorResponse {
+	status, ok := errorStatus[err.StatusCode]
+	if !ok {
+		status = "UNKNOWN"
+	}
+	return &ErrorResponse{
+		Error: Error{
+			Code:    err.StatusCode,
+			Message: err.Message,
+			Status:  status,
+		},
+	}
+}
@@ -0,0 +1,514 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common"
+	"github.com/xiaoxiongmao5/we-api/common/media"
+	"github.com/xiaoxiongmao5/we-api/common/render"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+const (
+	dataPrefix = "data:"
+
+	// 网关默认不做内容过滤，交给上游和调用方处理
+	defaultSafetyThreshold = "BLOCK_NONE"
+)
+
+var safetyCategories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+	"HARM_CATEGORY_CIVIC_INTEGRITY",
+}
+
+// Gemini 的 responseSchema 只支持 OpenAPI schema 的一个子集，不认识的字段会直接报错
+var unsupportedSchemaKeys = []string{"$schema", "additionalProperties", "strict"}
+
+func finishReasonGemini2OpenAI(reason string) string {
+	switch reason {
+	case "":
+		return ""
+	case "STOP":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func cleanSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		cleaned := make(map[string]any, len(v))
+		for key, value := range v {
+			cleaned[key] = cleanSchema(value)
+		}
+		for _, key := range unsupportedSchemaKeys {
+			delete(cleaned, key)
+		}
+		return cleaned
+	case []any:
+		cleaned := make([]any, len(v))
+		for i, value := range v {
+			cleaned[i] = cleanSchema(value)
+		}
+		return cleaned
+	default:
+		return schema
+	}
+}
+
+func ConvertRequest(ctx context.Context, textRequest model.GeneralOpenAIRequest) (*ChatRequest, error) {
+	if textRequest.HasAudioOutput() {
+		return nil, errors.New("gemini does not support audio output")
+	}
+	geminiRequest := ChatRequest{
+		Contents: make([]ChatContent, 0, len(textRequest.Messages)),
+		GenerationConfig: ChatGenerationConfig{
+			Temperature:      textRequest.Temperature,
+			TopP:             textRequest.TopP,
+			TopK:             textRequest.TopK,
+			MaxOutputTokens:  textRequest.MaxTokens,
+			CandidateCount:   textRequest.N,
+			StopSequences:    textRequest.ParseStop(),
+			PresencePenalty:  textRequest.PresencePenalty,
+			FrequencyPenalty: textRequest.FrequencyPenalty,
+			Seed:             int(textRequest.Seed),
+		},
+	}
+	if geminiRequest.GenerationConfig.MaxOutputTokens == 0 && textRequest.MaxCompletionTokens != nil {
+		geminiRequest.GenerationConfig.MaxOutputTokens = *textRequest.MaxCompletionTokens
+	}
+
+	for _, category := range safetyCategories {
+		geminiRequest.SafetySettings = append(geminiRequest.SafetySettings, ChatSafetySettings{
+			Category:  category,
+			Threshold: defaultSafetyThreshold,
+		})
+	}
+
+	if textRequest.ResponseFormat != nil {
+		switch textRequest.ResponseFormat.Type {
+		case "json_object":
+			geminiRequest.GenerationConfig.ResponseMimeType = "application/json"
+		case "json_schema":
+			geminiRequest.GenerationConfig.ResponseMimeType = "application/json"
+			if textRequest.ResponseFormat.JsonSchema != nil {
+				geminiRequest.GenerationConfig.ResponseSchema = cleanSchema(textRequest.ResponseFormat.JsonSchema.Schema)
+			}
+		}
+	}
+
+	for _, tool := range textRequest.Tools {
+		if len(geminiRequest.Tools) == 0 {
+			geminiRequest.Tools = []ChatTools{{}}
+		}
+		declaration := FunctionDeclaration{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+		}
+		if tool.Function.Parameters != nil {
+			declaration.Parameters = cleanSchema(tool.Function.Parameters)
+		}
+		geminiRequest.Tools[0].FunctionDeclarations = append(geminiRequest.Tools[0].FunctionDeclarations, declaration)
+	}
+	if len(geminiRequest.Tools) > 0 {
+		geminiRequest.ToolConfig = toolChoiceOpenAI2Gemini(textRequest.ToolChoice)
+	}
+
+	// tool 消息只有 tool_call_id，Gemini 的 functionResponse 需要函数名
+	toolNames := make(map[string]string)
+	var systemParts []Part
+	for _, message := range textRequest.Messages {
+		if message.Role == model.RoleSystem || message.Role == model.RoleDeveloper {
+			systemParts = append(systemParts, Part{Text: message.StringContent()})
+			continue
+		}
+
+		content := ChatContent{
+			Role:  message.Role,
+			Parts: []Part{},
+		}
+		// Gemini 中助手的角色是 model
+		if content.Role == model.RoleAssistant {
+			content.Role = "model"
+		} else {
+			content.Role = model.RoleUser
+		}
+
+		if message.Role == model.RoleTool {
+			content.Parts = append(content.Parts, Part{
+				FunctionResponse: &FunctionResponse{
+					Name:     toolNames[message.ToolCallId],
+					Response: toolResponse(message.StringContent()),
+				},
+			})
+		} else {
+			for _, part := range message.ParseContent() {
+				switch part.Type {
+				case model.ContentTypeText:
+					content.Parts = append(content.Parts, Part{Text: part.Text})
+				case model.ContentTypeImageURL:
+					mimeType, data, err := media.GetImage(ctx, part.ImageURL.Url)
+					if err != nil {
+						return nil, err
+					}
+					content.Parts = append(content.Parts, Part{
+						InlineData: &InlineData{
+							MimeType: mimeType,
+							Data:     data,
+						},
+					})
+				case model.ContentTypeInputAudio:
+					content.Parts = append(content.Parts, Part{
+						InlineData: &InlineData{
+							MimeType: "audio/" + part.InputAudio.Format,
+							Data:     part.InputAudio.Data,
+						},
+					})
+				}
+			}
+			for _, toolCall := range message.ToolCalls {
+				toolNames[toolCall.Id] = toolCall.Function.Name
+				var args map[string]any
+				if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil || args == nil {
+					args = map[string]any{}
+				}
+				content.Parts = append(content.Parts, Part{
+					FunctionCall: &FunctionCall{
+						Name: toolCall.Function.Name,
+						Args: args,
+					},
+				})
+			}
+		}
+		if len(content.Parts) == 0 {
+			continue
+		}
+
+		// 多个工具结果需要放在同一条消息中，相邻的同角色消息合并
+		if n := len(geminiRequest.Contents); n > 0 && geminiRequest.Contents[n-1].Role == content.Role {
+			geminiRequest.Contents[n-1].Parts = append(geminiRequest.Contents[n-1].Parts, content.Parts...)
+			continue
+		}
+		geminiRequest.Contents = append(geminiRequest.Contents, content)
+	}
+	if len(systemParts) > 0 {
+		geminiRequest.SystemInstruction = &ChatContent{Parts: systemParts}
+	}
+
+	return &geminiRequest, nil
+}
+
+// toolChoiceOpenAI2Gemini tool_choice 可以是 none auto required 或者指定函数的对象
+func toolChoiceOpenAI2Gemini(toolChoice any) *ToolConfig {
+	switch v := toolChoice.(type) {
+	case string:
+		switch v {
+		case "none":
+			return &ToolConfig{FunctionCallingConfig: FunctionCallingConfig{Mode: "NONE"}}
+		case "required":
+			return &ToolConfig{FunctionCallingConfig: FunctionCallingConfig{Mode: "ANY"}}
+		case "auto":
+			return &ToolConfig{FunctionCallingConfig: FunctionCallingConfig{Mode: "AUTO"}}
+		}
+	case map[string]any:
+		if function, ok := v["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok {
+				return &ToolConfig{FunctionCallingConfig: FunctionCallingConfig{
+					Mode:                 "ANY",
+					AllowedFunctionNames: []string{name},
+				}}
+			}
+		}
+	}
+	return nil
+}
+
+// toolResponse functionResponse 的 response 必须是对象，工具结果不是 JSON 对象时包一层
+func toolResponse(content string) any {
+	var response map[string]any
+	if err := json.Unmarshal([]byte(content), &response); err == nil && response != nil {
+		return response
+	}
+	return map[string]any{"content": content}
+}
+
+// toolCalls 把候选结果中的 functionCall 转成 OpenAI 的工具调用，Gemini 不返回调用 id，这里生成一个。
+// offset 为之前已经输出的调用数，流式响应中的调用分布在多个块中，需要连续编号
+func (c ChatCandidate) toolCalls(offset int) []model.ToolCall {
+	var toolCalls []model.ToolCall
+	for _, part := range c.Content.Parts {
+		if part.FunctionCall == nil {
+			continue
+		}
+		arguments, _ := json.Marshal(part.FunctionCall.Args)
+		index := offset + len(toolCalls)
+		toolCalls = append(toolCalls, model.ToolCall{
+			Index: &index,
+			Id:    fmt.Sprintf("call_%d_%d", time.Now().UnixNano(), index),
+			Type:  model.ToolTypeFunction,
+			Function: model.FunctionCall{
+				Name:      part.FunctionCall.Name,
+				Arguments: string(arguments),
+			},
+		})
+	}
+	return toolCalls
+}
+
+func (c ChatCandidate) text() string {
+	var builder strings.Builder
+	for _, part := range c.Content.Parts {
+		builder.WriteString(part.Text)
+	}
+	return builder.String()
+}
+
+func usageGemini2OpenAI(usage *UsageMetadata) *model.Usage {
+	if usage == nil {
+		return nil
+	}
+	// 思考消耗的 token 也按输出计费
+	completionTokens := usage.CandidatesTokenCount + usage.ThoughtsTokenCount
+	openaiUsage := &model.Usage{
+		PromptTokens:     usage.PromptTokenCount,
+		CompletionTokens: completionTokens,
+		TotalTokens:      usage.PromptTokenCount + completionTokens,
+	}
+	if usage.ThoughtsTokenCount > 0 {
+		openaiUsage.CompletionTokensDetails = &model.CompletionTokensDetails{
+			ReasoningTokens: usage.ThoughtsTokenCount,
+		}
+	}
+	for _, detail := range usage.PromptTokensDetails {
+		if detail.Modality == "AUDIO" {
+			openaiUsage.PromptTokensDetails = &model.PromptTokensDetails{
+				AudioTokens: detail.TokenCount,
+			}
+		}
+	}
+	return openaiUsage
+}
+
+func responseGemini2OpenAI(response *ChatResponse, modelName string) *openai.TextResponse {
+	fullTextResponse := openai.TextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano()),
+		Model:   modelName,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Choices: make([]openai.TextResponseChoice, 0, len(response.Candidates)),
+	}
+	for i, candidate := range response.Candidates {
+		choice := openai.TextResponseChoice{
+			Index: i,
+			Message: model.Message{
+				Role:    model.RoleAssistant,
+				Content: candidate.text(),
+			},
+			FinishReason: finishReasonGemini2OpenAI(candidate.FinishReason),
+		}
+		if toolCalls := candidate.toolCalls(0); len(toolCalls) > 0 {
+			// 非流式响应中的工具调用不带 index
+			for j := range toolCalls {
+				toolCalls[j].Index = nil
+			}
+			choice.Message.ToolCalls = toolCalls
+			// 因长度或安全原因结束时保留原因，客户端需要知道工具调用可能不完整
+			if choice.FinishReason == "stop" {
+				choice.FinishReason = "tool_calls"
+			}
+		}
+		fullTextResponse.Choices = append(fullTextResponse.Choices, choice)
+	}
+	// 提示词被拦截时没有候选结果
+	if len(response.Candidates) == 0 && response.PromptFeedback != nil && response.PromptFeedback.BlockReason != "" {
+		fullTextResponse.Choices = append(fullTextResponse.Choices, openai.TextResponseChoice{
+			Message:      model.Message{Role: "assistant", Content: ""},
+			FinishReason: "content_filter",
+		})
+	}
+	return &fullTextResponse
+}
+
+// streamToolCalls 记录流式响应中每个候选结果已经输出的工具调用数
+type streamToolCalls map[int]int
+
+func streamResponseGemini2OpenAI(response *ChatResponse, id string, modelName string, created int64, sent streamToolCalls) *openai.ChatCompletionsStreamResponse {
+	chunk := openai.ChatCompletionsStreamResponse{
+		Id:      id,
+		Model:   modelName,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Choices: make([]openai.ChatCompletionsStreamResponseChoice, 0, len(response.Candidates)),
+	}
+	for i, candidate := range response.Candidates {
+		choice := openai.ChatCompletionsStreamResponseChoice{
+			Index: i,
+			Message: model.Message{
+				Role:    model.RoleAssistant,
+				Content: candidate.text(),
+			},
+		}
+		// Gemini 流式响应中的函数调用是完整返回的，一次性作为增量输出
+		if toolCalls := candidate.toolCalls(sent[i]); len(toolCalls) > 0 {
+			choice.Message.ToolCalls = toolCalls
+			sent[i] += len(toolCalls)
+		}
+		// 结束原因可能在函数调用之后的块中才返回
+		finishReason := finishReasonGemini2OpenAI(candidate.FinishReason)
+		if finishReason == "stop" && sent[i] > 0 {
+			finishReason = "tool_calls"
+		}
+		if finishReason != "" {
+			choice.FinishReason = &finishReason
+		}
+		chunk.Choices = append(chunk.Choices, choice)
+	}
+	return &chunk
+}
+
+func StreamHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	common.SetEventStreamHeaders(c)
+
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+	var usage *model.Usage
+	// 还没有收到 usageMetadata 就中断时按已经输出的内容估算
+	var responseText strings.Builder
+	sent := make(streamToolCalls)
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		data := scanner.Text()
+		if !strings.HasPrefix(data, dataPrefix) {
+			continue
+		}
+		data = strings.TrimSpace(strings.TrimPrefix(data, dataPrefix))
+
+		var geminiResponse ChatResponse
+		if err := json.Unmarshal([]byte(data), &geminiResponse); err != nil {
+			continue
+		}
+
+		// 每个块都带有截止当前的累计 usage，以最后一个为准
+		if geminiResponse.UsageMetadata != nil {
+			usage = usageGemini2OpenAI(geminiResponse.UsageMetadata)
+		}
+		if geminiResponse.ModelVersion != "" {
+			modelName = geminiResponse.ModelVersion
+		}
+		if len(geminiResponse.Candidates) == 0 {
+			continue
+		}
+		for _, part := range geminiResponse.Candidates[0].Content.Parts {
+			responseText.WriteString(part.Text)
+			if part.FunctionCall != nil {
+				args, _ := json.Marshal(part.FunctionCall.Args)
+				responseText.WriteString(part.FunctionCall.Name)
+				responseText.Write(args)
+			}
+		}
+
+		render.ObjectData(c, streamResponseGemini2OpenAI(&geminiResponse, id, modelName, created, sent))
+	}
+	if usage == nil && responseText.Len() > 0 {
+		usage = openai.ResponseText2Usage(responseText.String(), modelName, promptTokens)
+	}
+
+	if usage != nil {
+		render.ObjectData(c, &openai.ChatCompletionsStreamResponse{
+			Id:      id,
+			Model:   modelName,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Choices: []openai.ChatCompletionsStreamResponseChoice{},
+			Usage:   usage,
+		})
+	}
+	render.Done(c)
+
+	// 调用方断开连接或者上游中断时，按已经输出的内容计费
+	if err := scanner.Err(); err != nil {
+		resp.Body.Close()
+		return openai.ErrorWrapper(err, "read_stream_failed", http.StatusInternalServerError), usage
+	}
+
+	err := resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), usage
+	}
+
+	return nil, usage
+}
+
+func Handler(c *gin.Context, resp *http.Response, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	var geminiResponse ChatResponse
+	err = json.Unmarshal(responseBody, &geminiResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	if geminiResponse.ModelVersion != "" {
+		modelName = geminiResponse.ModelVersion
+	}
+	fullTextResponse := responseGemini2OpenAI(&geminiResponse, modelName)
+	usage := usageGemini2OpenAI(geminiResponse.UsageMetadata)
+	if usage != nil {
+		fullTextResponse.Usage = *usage
+	}
+
+	c.JSON(http.StatusOK, fullTextResponse)
+
+	return nil, usage
+}
+
+func ErrorHandler(resp *http.Response) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	resp.Body.Close()
+
+	var errorResponse ErrorResponse
+	if err = json.Unmarshal(responseBody, &errorResponse); err != nil || errorResponse.Error.Message == "" {
+		return openai.ErrorWrapper(fmt.Errorf("bad response status code %d: %s", resp.StatusCode, string(responseBody)), "bad_response_status_code", resp.StatusCode)
+	}
+
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: errorResponse.Error.Message,
+			Type:    "gemini_error",
+			Code:    errorResponse.Error.Status,
+		},
+		StatusCode: resp.StatusCode,
+	}
+}
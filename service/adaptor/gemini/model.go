@@ -0,0 +1,245 @@
+package gemini
+
+import "encoding/json"
+
+// https://ai.google.dev/api/generate-content
+// REST 接口同时接受 camelCase 和 snake_case 的字段名，入站请求中常见的几个字段两种写法都要解析
+
+type InlineData struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"` //base64 编码
+}
+
+func (d *InlineData) UnmarshalJSON(data []byte) error {
+	type alias InlineData
+	var raw struct {
+		alias
+		MimeType string `json:"mimeType"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*d = InlineData(raw.alias)
+	if d.MimeType == "" {
+		d.MimeType = raw.MimeType
+	}
+	return nil
+}
+
+// FileData 通过 File API 上传或者公网可以访问的文件
+type FileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileUri  string `json:"fileUri"`
+}
+
+type Part struct {
+	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"` //思考内容
+	InlineData       *InlineData       `json:"inline_data,omitempty"`
+	FileData         *FileData         `json:"fileData,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+}
+
+func (p *Part) UnmarshalJSON(data []byte) error {
+	type alias Part
+	var raw struct {
+		alias
+		InlineData       *InlineData       `json:"inlineData"`
+		FileData         *FileData         `json:"file_data"`
+		FunctionCall     *FunctionCall     `json:"function_call"`
+		FunctionResponse *FunctionResponse `json:"function_response"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*p = Part(raw.alias)
+	if p.InlineData == nil {
+		p.InlineData = raw.InlineData
+	}
+	if p.FileData == nil {
+		p.FileData = raw.FileData
+	}
+	if p.FunctionCall == nil {
+		p.FunctionCall = raw.FunctionCall
+	}
+	if p.FunctionResponse == nil {
+		p.FunctionResponse = raw.FunctionResponse
+	}
+	return nil
+}
+
+type FunctionCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args"`
+}
+
+type FunctionResponse struct {
+	Name     string `json:"name"`
+	Response any    `json:"response"` //必须是 JSON 对象
+}
+
+type FunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type ChatTools struct {
+	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations"`
+}
+
+type FunctionCallingConfig struct {
+	Mode                 string   `json:"mode"` //AUTO ANY NONE
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type ToolConfig struct {
+	FunctionCallingConfig FunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type ChatContent struct {
+	Role  string `json:"role,omitempty"`
+	Parts []Part `json:"parts"`
+}
+
+type ChatSafetySettings struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+type ChatGenerationConfig struct {
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+	ResponseSchema   any      `json:"responseSchema,omitempty"`
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	TopK             int      `json:"topK,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+	CandidateCount   int      `json:"candidateCount,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+	Seed             int      `json:"seed,omitempty"`
+}
+
+type ChatRequest struct {
+	Contents          []ChatContent        `json:"contents"`
+	SystemInstruction *ChatContent         `json:"systemInstruction,omitempty"`
+	SafetySettings    []ChatSafetySettings `json:"safetySettings,omitempty"`
+	GenerationConfig  ChatGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []ChatTools          `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig          `json:"toolConfig,omitempty"`
+}
+
+func (r *ChatRequest) UnmarshalJSON(data []byte) error {
+	type alias ChatRequest
+	var raw struct {
+		alias
+		SystemInstruction *ChatContent          `json:"system_instruction"`
+		SafetySettings    []ChatSafetySettings  `json:"safety_settings"`
+		GenerationConfig  *ChatGenerationConfig `json:"generation_config"`
+		ToolConfig        *ToolConfig           `json:"tool_config"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = ChatRequest(raw.alias)
+	if r.SystemInstruction == nil {
+		r.SystemInstruction = raw.SystemInstruction
+	}
+	if r.SafetySettings == nil {
+		r.SafetySettings = raw.SafetySettings
+	}
+	if raw.GenerationConfig != nil {
+		r.GenerationConfig = *raw.GenerationConfig
+	}
+	if r.ToolConfig == nil {
+		r.ToolConfig = raw.ToolConfig
+	}
+	return nil
+}
+
+type ChatCandidate struct {
+	Content      ChatContent `json:"content"`
+	FinishReason string      `json:"finishReason,omitempty"`
+	Index        int         `json:"index"`
+}
+
+type ModalityTokenCount struct {
+	Modality   string `json:"modality"` //TEXT IMAGE AUDIO VIDEO
+	TokenCount int    `json:"tokenCount"`
+}
+
+type UsageMetadata struct {
+	PromptTokenCount     int                  `json:"promptTokenCount"`
+	CandidatesTokenCount int                  `json:"candidatesTokenCount"`
+	TotalTokenCount      int                  `json:"totalTokenCount"`
+	ThoughtsTokenCount   int                  `json:"thoughtsTokenCount,omitempty"`
+	PromptTokensDetails  []ModalityTokenCount `json:"promptTokensDetails,omitempty"`
+}
+
+type ChatPromptFeedback struct {
+	BlockReason string `json:"blockReason,omitempty"`
+}
+
+type ChatResponse struct {
+	Candidates     []ChatCandidate     `json:"candidates"`
+	PromptFeedback *ChatPromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  *UsageMetadata      `json:"usageMetadata,omitempty"`
+	ModelVersion   string              `json:"modelVersion,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// https://ai.google.dev/api/embeddings
+
+type EmbeddingRequest struct {
+	Model                string      `json:"model"` //models/{model}
+	Content              ChatContent `json:"content"`
+	OutputDimensionality int         `json:"outputDimensionality,omitempty"`
+}
+
+type BatchEmbeddingRequest struct {
+	Requests []EmbeddingRequest `json:"requests"`
+}
+
+type EmbeddingData struct {
+	Values []float64 `json:"values"`
+}
+
+type BatchEmbeddingResponse struct {
+	Embeddings []EmbeddingData `json:"embeddings"`
+}
+
+// https://ai.google.dev/gemini-api/docs/imagen
+
+type ImageInstance struct {
+	Prompt string `json:"prompt"`
+}
+
+type ImageParameters struct {
+	SampleCount int    `json:"sampleCount,omitempty"`
+	AspectRatio string `json:"aspectRatio,omitempty"` //1:1 3:4 4:3 9:16 16:9
+}
+
+type ImageRequest struct {
+	Instances  []ImageInstance `json:"instances"`
+	Parameters ImageParameters `json:"parameters"`
+}
+
+type ImagePrediction struct {
+	BytesBase64Encoded string `json:"bytesBase64Encoded"`
+	MimeType           string `json:"mimeType"`
+}
+
+type ImageResponse struct {
+	Predictions []ImagePrediction `json:"predictions"`
+}
@@ -0,0 +1,188 @@
+package gemini
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+// ResponseWriter 把转发流程写出的 OpenAI 格式响应转换成 Gemini 格式。
+// 流式响应在请求带 alt=sse 时按 SSE 输出，否则和官方接口一样输出一个逐步写出的 JSON 数组
+type ResponseWriter struct {
+	*openai.TranscodeWriter
+	meta   *meta.Meta
+	stream bool
+	sse    bool
+
+	// 流式响应的状态
+	started      bool
+	toolCalls    map[int]*model.ToolCall //Gemini 的函数调用是完整返回的，参数拼接完成后再输出
+	finishReason string
+	usage        *model.Usage
+}
+
+func NewResponseWriter(c *gin.Context, meta *meta.Meta, stream bool) *ResponseWriter {
+	w := &ResponseWriter{
+		meta:      meta,
+		stream:    stream,
+		sse:       c.Query("alt") == "sse",
+		toolCalls: make(map[int]*model.ToolCall),
+	}
+	w.TranscodeWriter = openai.NewTranscodeWriter(c.Writer, stream, w.handleLine)
+	c.Writer = w
+	return w
+}
+
+// Finish 转发结束后调用，relayErr 为转发流程返回的错误
+func (w *ResponseWriter) Finish(relayErr *model.ErrorWithStatusCode) {
+	if w.stream && w.started {
+		// 上游在 [DONE] 之后仍可能返回读取错误，最后一块等转发结果确定后再输出
+		if relayErr != nil {
+			w.chunk(ErrorOpenAI2Gemini(relayErr))
+		} else {
+			w.finish()
+		}
+		if !w.sse {
+			w.ResponseWriter.Write([]byte("]"))
+		}
+		return
+	}
+
+	if relayErr != nil {
+		w.writeJSON(relayErr.StatusCode, ErrorOpenAI2Gemini(relayErr))
+		return
+	}
+
+	if w.stream {
+		// 上游没有返回任何内容
+		w.finish()
+		if !w.sse {
+			w.ResponseWriter.Write([]byte("]"))
+		}
+		return
+	}
+
+	var textResponse openai.TextResponse
+	if err := json.Unmarshal(w.Body(), &textResponse); err != nil {
+		w.writeJSON(http.StatusInternalServerError, ErrorOpenAI2Gemini(openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)))
+		return
+	}
+	w.writeJSON(http.StatusOK, ResponseOpenAI2Gemini(&textResponse, w.meta.FullMode))
+}
+
+func (w *ResponseWriter) writeJSON(code int, v any) {
+	jsonData, _ := json.Marshal(v)
+	header := w.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(code)
+	w.ResponseWriter.Write(jsonData)
+}
+
+// chunk 输出一个流式响应块
+func (w *ResponseWriter) chunk(v any) {
+	jsonData, _ := json.Marshal(v)
+	if !w.started {
+		w.started = true
+		if !w.sse {
+			w.ResponseWriter.Header().Set("Content-Type", "application/json")
+		}
+		w.ResponseWriter.WriteHeader(http.StatusOK)
+		if !w.sse {
+			w.ResponseWriter.Write([]byte("["))
+		}
+	} else if !w.sse {
+		w.ResponseWriter.Write([]byte(",\r\n"))
+	}
+
+	if w.sse {
+		w.ResponseWriter.Write([]byte("data: "))
+		w.ResponseWriter.Write(jsonData)
+		w.ResponseWriter.Write([]byte("\n\n"))
+	} else {
+		w.ResponseWriter.Write(jsonData)
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *ResponseWriter) handleLine(line string) {
+	if !strings.HasPrefix(line, dataPrefix) {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, dataPrefix))
+	if data == "[DONE]" {
+		return
+	}
+
+	var chunk openai.ChatCompletionsStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return
+	}
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		w.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			w.chunk(&ChatResponse{
+				Candidates: []ChatCandidate{{
+					Content: ChatContent{Role: "model", Parts: []Part{{Text: text}}},
+				}},
+				ModelVersion: w.meta.FullMode,
+			})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			index := 0
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			call, ok := w.toolCalls[index]
+			if !ok {
+				call = &model.ToolCall{}
+				w.toolCalls[index] = call
+			}
+			if toolCall.Function.Name != "" {
+				call.Function.Name = toolCall.Function.Name
+			}
+			call.Function.Arguments += toolCall.Function.Arguments
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = *choice.FinishReason
+		}
+	}
+}
+
+// finish 上游的 usage 在 finish_reason 之后才返回，转发成功结束后再输出带 finishReason 和 usageMetadata 的最后一块
+func (w *ResponseWriter) finish() {
+	indexes := make([]int, 0, len(w.toolCalls))
+	for index := range w.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	toolCalls := make([]model.ToolCall, 0, len(indexes))
+	for _, index := range indexes {
+		toolCalls = append(toolCalls, *w.toolCalls[index])
+	}
+
+	usage := w.usage
+	if usage == nil {
+		usage = &model.Usage{PromptTokens: w.meta.PromptTokens}
+	}
+	w.chunk(&ChatResponse{
+		Candidates: []ChatCandidate{{
+			Content:      ChatContent{Role: "model", Parts: candidateParts("", toolCalls)},
+			FinishReason: finishReasonOpenAI2Gemini(w.finishReason),
+		}},
+		UsageMetadata: usageOpenAI2Gemini(usage),
+		ModelVersion:  w.meta.FullMode,
+	})
+}
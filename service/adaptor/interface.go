@@ -1,6 +1,7 @@
 package adaptor
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -12,6 +13,8 @@ type Adaptor interface {
 	GetRequestURL(meta *meta.Meta) (string, error)
 	SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error
 	ConvertRequest(c *gin.Context, meta *meta.Meta, request *model.GeneralOpenAIRequest) (any, error)
-	// ConvertImageRequest(request *model.ImageRequest) (any, error)
+	ConvertImageRequest(request *model.ImageRequest) (any, error)
+	// ConvertAudioRequest 转写和翻译请求是 multipart 表单，直接返回请求体
+	ConvertAudioRequest(c *gin.Context, meta *meta.Meta, request *model.AudioRequest) (io.Reader, error)
 	DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode)
 }
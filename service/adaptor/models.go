@@ -0,0 +1,119 @@
+package adaptor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/xiaoxiongmao5/we-api/relay/apitype"
+	"github.com/xiaoxiongmao5/we-api/xnet/xresty/xhttp"
+)
+
+type openaiModelList struct {
+	Data []struct {
+		Id string `json:"id"`
+	} `json:"data"`
+}
+
+type geminiModelList struct {
+	Models []struct {
+		Name string `json:"name"` //models/gemini-2.0-flash
+	} `json:"models"`
+}
+
+// anthropicModelList Anthropic 的模型列表同样是 data[].id，按 after_id 分页
+type anthropicModelList struct {
+	openaiModelList
+	HasMore bool   `json:"has_more"`
+	LastId  string `json:"last_id"`
+}
+
+// anthropicModelsPageSize Anthropic 模型列表每页的最大数量，默认只返回 20 个
+const anthropicModelsPageSize = 1000
+
+// FetchUpstreamModels 请求上游的模型列表接口，返回上游的模型名
+func FetchUpstreamModels(ctx context.Context, apiType string, baseURL string, apiKey string, headers map[string]string) ([]string, error) {
+	var names []string
+	switch apiType {
+	case apitype.OpenAI, apitype.Ollama:
+		// Ollama 的 OpenAI 兼容接口同样提供 /v1/models
+		var list openaiModelList
+		if err := getModels(ctx, apiType, baseURL+"/v1/models", apiKey, headers, &list); err != nil {
+			return nil, err
+		}
+		for _, m := range list.Data {
+			names = append(names, m.Id)
+		}
+	case apitype.Anthropic:
+		afterId := ""
+		for {
+			url := fmt.Sprintf("%s/v1/models?limit=%d", baseURL, anthropicModelsPageSize)
+			if afterId != "" {
+				url += "&after_id=" + neturl.QueryEscape(afterId)
+			}
+			var list anthropicModelList
+			if err := getModels(ctx, apiType, url, apiKey, headers, &list); err != nil {
+				return nil, err
+			}
+			for _, m := range list.Data {
+				names = append(names, m.Id)
+			}
+			if !list.HasMore || list.LastId == "" || list.LastId == afterId {
+				break
+			}
+			afterId = list.LastId
+		}
+	case apitype.Gemini:
+		var list geminiModelList
+		if err := getModels(ctx, apiType, baseURL+"/v1beta/models?pageSize=1000", apiKey, headers, &list); err != nil {
+			return nil, err
+		}
+		for _, m := range list.Models {
+			names = append(names, strings.TrimPrefix(m.Name, "models/"))
+		}
+	default:
+		return nil, fmt.Errorf("api type %s does not support listing models", apiType)
+	}
+	return names, nil
+}
+
+// getModels 请求一页模型列表，解析到 list 中
+func getModels(ctx context.Context, apiType string, url string, apiKey string, headers map[string]string, list any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	switch apiType {
+	case apitype.Anthropic:
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+	case apitype.Gemini:
+		req.Header.Set("x-goog-api-key", apiKey)
+	default:
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := xhttp.NewClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad response status code %d: %s", resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, list)
+}
@@ -0,0 +1,69 @@
+package ollama
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+// Adaptor 对话使用 Ollama 的 OpenAI 兼容接口，向量使用原生的 /api/embed
+type Adaptor struct {
+	openai.Adaptor
+	encodingFormat string //向量请求的 encoding_format，转换响应时使用
+}
+
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	switch meta.Mode {
+	case relaymode.Embeddings:
+		return meta.BaseURL + "/api/embed", nil
+	}
+	return a.Adaptor.GetRequestURL(meta)
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	// 本地部署的服务通常不需要鉴权
+	if meta.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	}
+
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, meta *meta.Meta, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+
+	switch meta.Mode {
+	case relaymode.Embeddings:
+		a.encodingFormat = request.EncodingFormat
+		return ConvertEmbeddingRequest(*request)
+	}
+	return a.Adaptor.ConvertRequest(c, meta, request)
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	return nil, errors.New("ollama does not support image generation")
+}
+
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, request *model.AudioRequest) (io.Reader, error) {
+	return nil, errors.New("ollama does not support audio transcription")
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	switch meta.Mode {
+	case relaymode.Embeddings:
+		if resp.StatusCode != http.StatusOK {
+			return nil, ErrorHandler(resp)
+		}
+		err, usage = EmbeddingHandler(c, resp, meta.ActualModelName, a.encodingFormat, meta.PromptTokens)
+		return
+	}
+	return a.Adaptor.DoResponse(c, resp, meta)
+}
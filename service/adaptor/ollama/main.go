@@ -0,0 +1,82 @@
+package ollama
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) (*EmbeddingRequest, error) {
+	input := request.ParseInput()
+	if len(input) == 0 && request.InputTokens() > 0 {
+		return nil, errors.New("token array input is not supported")
+	}
+	if len(input) == 0 {
+		return nil, errors.New("input is empty")
+	}
+
+	return &EmbeddingRequest{
+		Model:      request.Model,
+		Input:      input,
+		Dimensions: request.Dimensions,
+	}, nil
+}
+
+// EmbeddingHandler 优先使用 Ollama 返回的 prompt_eval_count 计费
+func EmbeddingHandler(c *gin.Context, resp *http.Response, modelName string, encodingFormat string, promptTokens int) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	var embeddingResponse EmbeddingResponse
+	err = json.Unmarshal(responseBody, &embeddingResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	if embeddingResponse.PromptEvalCount > 0 {
+		promptTokens = embeddingResponse.PromptEvalCount
+	}
+	usage := model.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+
+	c.JSON(http.StatusOK, openai.NewEmbeddingResponse(embeddingResponse.Embeddings, modelName, encodingFormat, usage))
+
+	return nil, &usage
+}
+
+func ErrorHandler(resp *http.Response) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	resp.Body.Close()
+
+	var errorResponse ErrorResponse
+	if err = json.Unmarshal(responseBody, &errorResponse); err != nil || errorResponse.Error == "" {
+		return openai.ErrorWrapper(fmt.Errorf("bad response status code %d: %s", resp.StatusCode, string(responseBody)), "bad_response_status_code", resp.StatusCode)
+	}
+
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message: errorResponse.Error,
+			Type:    "ollama_error",
+			Code:    "bad_response_status_code",
+		},
+		StatusCode: resp.StatusCode,
+	}
+}
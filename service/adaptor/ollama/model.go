@@ -0,0 +1,19 @@
+package ollama
+
+// https://github.com/ollama/ollama/blob/main/docs/api.md#generate-embeddings
+
+type EmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type EmbeddingResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float64 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
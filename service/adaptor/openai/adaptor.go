@@ -2,31 +2,44 @@ package openai
 
 import (
 	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/xiaoxiongmao5/we-api/meta"
 	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
 )
 
 type Adaptor struct {
+	contentType string //转写请求重新编码后的 multipart Content-Type
 }
 
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
-	url := "https://api.damser.xyz/v1/chat/completions"
-
-	if meta.IsStream {
-		return url, nil
+	switch meta.Mode {
+	case relaymode.Embeddings:
+		return meta.BaseURL + "/v1/embeddings", nil
+	case relaymode.ImagesGenerations:
+		return meta.BaseURL + "/v1/images/generations", nil
+	case relaymode.AudioSpeech:
+		return meta.BaseURL + "/v1/audio/speech", nil
+	case relaymode.AudioTranscription:
+		return meta.BaseURL + "/v1/audio/transcriptions", nil
+	case relaymode.AudioTranslation:
+		return meta.BaseURL + "/v1/audio/translations", nil
+	case relaymode.Responses:
+		return meta.BaseURL + "/v1/responses", nil
+	case relaymode.Completions:
+		return meta.BaseURL + "/v1/completions", nil
 	}
 
-	return url, nil
+	return meta.BaseURL + "/v1/chat/completions", nil
 }
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
 	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
-
-	if meta.IsStream {
-		return nil
+	if a.contentType != "" {
+		req.Header.Set("Content-Type", a.contentType)
 	}
 
 	return nil
@@ -45,15 +58,56 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, meta *meta.Meta, request *model
 			}
 		}
 	}
+	if meta.Mode == relaymode.Completions {
+		return &model.CompletionsRequest{GeneralOpenAIRequest: *request, Logprobs: request.CompletionLogprobs}, nil
+	}
 	return request, nil
 }
 
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return request, nil
+}
+
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, request *model.AudioRequest) (io.Reader, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+
+	body, contentType, err := ConvertAudioRequest(*request)
+	if err != nil {
+		return nil, err
+	}
+	a.contentType = contentType
+	return body, nil
+}
+
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
-	if meta.IsStream {
-		err, _, usage = StreamHandler(c, resp)
-	} else {
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrorHandler(resp)
+	}
+
+	switch {
+	case meta.Mode == relaymode.ImagesGenerations:
+		// 图片按张数计费，不使用响应中的 usage
+		err, _ = Handler(c, resp)
+		return nil, err
+	case meta.Mode == relaymode.AudioSpeech:
+		// 语音合成按字符数预扣，成功后不再结算
+		return nil, SpeechHandler(c, resp)
+	case meta.Mode == relaymode.AudioTranscription || meta.Mode == relaymode.AudioTranslation:
+		err, usage = AudioHandler(c, resp)
+	case meta.IsStream:
+		err, _, usage = StreamHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	default:
 		err, usage = Handler(c, resp)
 	}
+	// 部分兼容接口的向量响应不带 usage，按预估的 token 数计费
+	if err == nil && meta.Mode == relaymode.Embeddings && (usage == nil || usage.TotalTokens == 0) {
+		usage = &model.Usage{PromptTokens: meta.PromptTokens, TotalTokens: meta.PromptTokens}
+	}
 
 	return
 }
@@ -0,0 +1,133 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+)
+
+type audioUsage struct {
+	Type         string  `json:"type"` //duration tokens
+	Seconds      float64 `json:"seconds"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+}
+
+// audioResponse 只解析计费需要的字段，verbose_json 格式带有 duration
+type audioResponse struct {
+	Duration float64     `json:"duration"`
+	Usage    *audioUsage `json:"usage"`
+}
+
+// BuildAudioForm 重新编码 multipart 表单，返回请求体和带 boundary 的 Content-Type
+func BuildAudioForm(file []byte, fileName string, fields url.Values) (io.Reader, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for k, values := range fields {
+		for _, v := range values {
+			if err := writer.WriteField(k, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err = part.Write(file); err != nil {
+		return nil, "", err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body, writer.FormDataContentType(), nil
+}
+
+func ConvertAudioRequest(request model.AudioRequest) (io.Reader, string, error) {
+	fields := make(url.Values, len(request.Fields)+2)
+	for k, values := range request.Fields {
+		fields[k] = values
+	}
+	fields.Set("model", request.Model)
+	if request.ResponseFormat != "" {
+		fields.Set("response_format", request.ResponseFormat)
+	}
+	return BuildAudioForm(request.File, request.FileName, fields)
+}
+
+// SpeechHandler 音频边读边写给调用方，不等上游全部返回
+func SpeechHandler(c *gin.Context, resp *http.Response) *model.ErrorWithStatusCode {
+	defer resp.Body.Close()
+
+	for _, k := range []string{"Content-Type", "Content-Disposition"} {
+		if v := resp.Header.Get(k); v != "" {
+			c.Writer.Header().Set(k, v)
+		}
+	}
+	c.Writer.WriteHeader(resp.StatusCode)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
+				return ErrorWrapper(writeErr, "write_response_body_failed", http.StatusInternalServerError)
+			}
+			c.Writer.Flush()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		}
+	}
+}
+
+// AudioHandler 透传转写结果，能解析出音频时长或 token 数时按实际用量计费
+func AudioHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		c.Writer.Header().Set("Content-Type", contentType)
+	}
+	c.Writer.WriteHeader(resp.StatusCode)
+
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	// text srt vtt 格式无法解析，按预扣额度计费
+	var audioResp audioResponse
+	if err = json.Unmarshal(responseBody, &audioResp); err != nil {
+		return nil, nil
+	}
+	switch {
+	case audioResp.Usage != nil && audioResp.Usage.Type == "tokens":
+		return nil, &model.Usage{
+			PromptTokens:     audioResp.Usage.InputTokens,
+			CompletionTokens: audioResp.Usage.OutputTokens,
+			TotalTokens:      audioResp.Usage.InputTokens + audioResp.Usage.OutputTokens,
+		}
+	case audioResp.Usage != nil && audioResp.Usage.Type == "duration":
+		return nil, &model.Usage{Type: "duration", Seconds: audioResp.Usage.Seconds}
+	case audioResp.Duration > 0:
+		return nil, &model.Usage{Type: "duration", Seconds: audioResp.Duration}
+	}
+	return nil, nil
+}
@@ -0,0 +1,212 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/completions/object
+
+type TextCompletionChoice struct {
+	Text         string  `json:"text"`
+	Index        int     `json:"index"`
+	Logprobs     any     `json:"logprobs"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+type TextCompletionResponse struct {
+	Id      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []TextCompletionChoice `json:"choices"`
+	Usage   *model.Usage           `json:"usage,omitempty"`
+}
+
+// ConvertCompletionsRequest 把文本补全请求的 prompt 包装成一条用户消息，用于只支持对话接口的上游。
+// 对话接口无法表达的参数直接返回错误，不静默忽略
+func ConvertCompletionsRequest(request *model.GeneralOpenAIRequest) (*model.GeneralOpenAIRequest, error) {
+	prompt, ok := request.Prompt.(string)
+	if !ok {
+		prompts := request.ParsePrompt()
+		if len(prompts) != 1 {
+			return nil, errors.New("only a single text prompt is supported by this model")
+		}
+		prompt = prompts[0]
+	}
+	if request.Suffix != "" {
+		return nil, errors.New("suffix is not supported by this model")
+	}
+	if request.CompletionLogprobs != nil {
+		return nil, errors.New("logprobs is not supported by this model")
+	}
+	if request.BestOf > 1 && request.BestOf != request.N {
+		return nil, errors.New("best_of is not supported by this model")
+	}
+
+	return &model.GeneralOpenAIRequest{
+		Messages:         []model.Message{{Role: model.RoleUser, Content: prompt}},
+		Model:            request.Model,
+		FrequencyPenalty: request.FrequencyPenalty,
+		LogitBias:        request.LogitBias,
+		MaxTokens:        request.MaxTokens,
+		N:                request.N,
+		PresencePenalty:  request.PresencePenalty,
+		Seed:             request.Seed,
+		Stop:             request.Stop,
+		Stream:           request.Stream,
+		StreamOptions:    request.StreamOptions,
+		Temperature:      request.Temperature,
+		TopP:             request.TopP,
+		User:             request.User,
+	}, nil
+}
+
+// CompletionsWriter 把对话接口的响应转换成 text_completion 格式，echo 时在输出前加上 prompt
+type CompletionsWriter struct {
+	*TranscodeWriter
+	meta    *meta.Meta
+	stream  bool
+	prompt  string
+	echo    bool
+	created int64
+	started bool
+	echoed  map[int]bool //已经输出过 prompt 的候选
+}
+
+func NewCompletionsWriter(c *gin.Context, meta *meta.Meta, request *model.GeneralOpenAIRequest) *CompletionsWriter {
+	w := &CompletionsWriter{
+		meta:    meta,
+		stream:  request.Stream,
+		echo:    request.Echo,
+		created: time.Now().Unix(),
+		echoed:  make(map[int]bool),
+	}
+	if prompts := request.ParsePrompt(); len(prompts) > 0 {
+		w.prompt = prompts[0]
+	}
+	w.TranscodeWriter = NewTranscodeWriter(c.Writer, request.Stream, w.handleLine)
+	c.Writer = w
+	return w
+}
+
+// Finish 转发结束后调用，relayErr 为转发流程返回的错误
+func (w *CompletionsWriter) Finish(relayErr *model.ErrorWithStatusCode) {
+	// 流式响应已经开始时只能以事件的形式返回错误；上游在 [DONE] 之后仍可能返回读取错误，[DONE] 留到这里再输出
+	if w.stream && w.started && relayErr != nil {
+		w.data(gin.H{"error": relayErr.Error})
+		return
+	}
+
+	if relayErr != nil {
+		w.writeJSON(relayErr.StatusCode, gin.H{"error": relayErr.Error})
+		return
+	}
+
+	if w.stream {
+		w.data(done)
+		return
+	}
+
+	var textResponse TextResponse
+	if err := json.Unmarshal(w.Body(), &textResponse); err != nil {
+		w.writeJSON(http.StatusInternalServerError, gin.H{"error": ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError).Error})
+		return
+	}
+	completion := TextCompletionResponse{
+		Id:      w.id(textResponse.Id),
+		Object:  "text_completion",
+		Created: w.created,
+		Model:   w.meta.FullMode,
+		Choices: make([]TextCompletionChoice, 0, len(textResponse.Choices)),
+		Usage:   &textResponse.Usage,
+	}
+	for _, choice := range textResponse.Choices {
+		finishReason := choice.FinishReason
+		text := choice.Message.StringContent()
+		if w.echo {
+			text = w.prompt + text
+		}
+		completion.Choices = append(completion.Choices, TextCompletionChoice{
+			Text:         text,
+			Index:        choice.Index,
+			FinishReason: &finishReason,
+		})
+	}
+	w.writeJSON(http.StatusOK, &completion)
+}
+
+func (w *CompletionsWriter) id(chatId string) string {
+	return "cmpl-" + strings.TrimPrefix(chatId, "chatcmpl-")
+}
+
+// data 输出一个流式响应块，v 为字符串时原样输出
+func (w *CompletionsWriter) data(v any) {
+	if !w.started {
+		w.started = true
+		w.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	str, ok := v.(string)
+	if !ok {
+		jsonData, _ := json.Marshal(v)
+		str = string(jsonData)
+	}
+	fmt.Fprintf(w.ResponseWriter, "data: %s\n\n", str)
+	w.ResponseWriter.Flush()
+}
+
+func (w *CompletionsWriter) writeJSON(code int, v any) {
+	jsonData, _ := json.Marshal(v)
+	header := w.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(code)
+	w.ResponseWriter.Write(jsonData)
+}
+
+func (w *CompletionsWriter) handleLine(line string) {
+	if !strings.HasPrefix(line, dataPrefix) {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, dataPrefix))
+	if data == done {
+		return
+	}
+
+	var chunk ChatCompletionsStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return
+	}
+	completion := TextCompletionResponse{
+		Id:      w.id(chunk.Id),
+		Object:  "text_completion",
+		Created: w.created,
+		Model:   w.meta.FullMode,
+		Choices: make([]TextCompletionChoice, 0, len(chunk.Choices)),
+	}
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		completion.Usage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		text := choice.Message.StringContent()
+		// echo 时在每个候选的第一个增量前输出 prompt
+		if w.echo && !w.echoed[choice.Index] {
+			w.echoed[choice.Index] = true
+			text = w.prompt + text
+		}
+		completion.Choices = append(completion.Choices, TextCompletionChoice{
+			Text:         text,
+			Index:        choice.Index,
+			FinishReason: choice.FinishReason,
+		})
+	}
+	w.data(&completion)
+}
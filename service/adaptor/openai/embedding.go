@@ -0,0 +1,54 @@
+package openai
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/embeddings/object
+
+type EmbeddingResponseItem struct {
+	Object    string `json:"object"`
+	Index     int    `json:"index"`
+	Embedding any    `json:"embedding"` //float 时是 []float64，base64 时是字符串
+}
+
+type EmbeddingResponse struct {
+	Object string                  `json:"object"`
+	Data   []EmbeddingResponseItem `json:"data"`
+	Model  string                  `json:"model"`
+	Usage  model.Usage             `json:"usage"`
+}
+
+// EmbeddingData 按 encoding_format 输出向量，base64 是小端序 float32 数组的编码，与 OpenAI 一致
+func EmbeddingData(values []float64, encodingFormat string) any {
+	if encodingFormat != "base64" {
+		return values
+	}
+	buf := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// NewEmbeddingResponse 把各家返回的向量组装成 OpenAI 的格式
+func NewEmbeddingResponse(embeddings [][]float64, modelName string, encodingFormat string, usage model.Usage) *EmbeddingResponse {
+	response := EmbeddingResponse{
+		Object: "list",
+		Data:   make([]EmbeddingResponseItem, 0, len(embeddings)),
+		Model:  modelName,
+		Usage:  usage,
+	}
+	for i, values := range embeddings {
+		response.Data = append(response.Data, EmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: EmbeddingData(values, encodingFormat),
+		})
+	}
+	return &response
+}
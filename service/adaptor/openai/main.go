@@ -2,7 +2,9 @@ package openai
 
 import (
 	"bufio"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -11,19 +13,29 @@ import (
 	"github.com/xiaoxiongmao5/we-api/common"
 	"github.com/xiaoxiongmao5/we-api/common/render"
 	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/tokenizer"
 )
 
+// 流式输出的音频固定为 pcm16 格式
+const streamAudioFormat = "pcm16"
+
 const (
 	dataPrefix       = "data: "
 	dataPrefixLength = len(dataPrefix)
 	done             = "[DONE]"
 )
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string, *model.Usage) {
+func StreamHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, string, *model.Usage) {
 	common.SetEventStreamHeaders(c)
 
+	var usage *model.Usage
+	var responseText strings.Builder
+	var toolCalls toolCallCollector
+	// 输出音频的字节数，上游没有返回 usage 时按时长估算音频 token
+	audioSize := 0
 	doneRendered := false
 	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
 	scanner.Split(bufio.ScanLines)
 	for scanner.Scan() {
 		data := scanner.Text()
@@ -52,42 +64,114 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			continue
 		}
 
-		render.StringData(c, data)
-	}
+		// 收集输出的文本和工具调用，上游没有返回 usage 时用来估算
+		patched := false
+		for _, choice := range streamResponse.Choices {
+			if reasoningContent, ok := choice.Message.ReasoningContent.(string); ok {
+				responseText.WriteString(reasoningContent)
+			}
+			responseText.WriteString(choice.Text)
+			responseText.WriteString(choice.Message.StringContent())
+			if choice.Message.Audio != nil {
+				responseText.WriteString(choice.Message.Audio.Transcript)
+				audioSize += base64.StdEncoding.DecodedLen(len(choice.Message.Audio.Data))
+			}
+			if len(choice.Message.ToolCalls) > 0 && toolCalls.add(choice.Message.ToolCalls) {
+				patched = true
+			}
+		}
 
-	// 返回扫描过程中发生的任何错误，如果是io.EOF时, err 返回 nil
-	if err := scanner.Err(); err != nil {
-		// [TODO]记日志
+		// 补上了工具调用的 index 时重新序列化，否则原样转发
+		if patched {
+			render.ObjectData(c, streamResponse)
+		} else {
+			render.StringData(c, data)
+		}
+		// 开启 include_usage 后最后一个块带有整个请求的 usage，其它块的 usage 为空
+		if streamResponse.Usage != nil && streamResponse.Usage.TotalTokens > 0 {
+			usage = streamResponse.Usage
+		}
 	}
 
 	if !doneRendered {
 		render.Done(c)
 	}
 
+	responseText.WriteString(toolCalls.text())
+	if usage == nil {
+		usage = ResponseText2Usage(responseText.String(), modelName, promptTokens)
+		if audioTokens := tokenizer.CountAudioSizeTokens(audioSize, streamAudioFormat); audioTokens > 0 {
+			usage.CompletionTokens += audioTokens
+			usage.TotalTokens += audioTokens
+			usage.CompletionTokensDetails = &model.CompletionTokensDetails{AudioTokens: audioTokens}
+		}
+	}
+
+	// 调用方断开连接或者上游中断时，按已经输出的内容计费
+	if err := scanner.Err(); err != nil {
+		resp.Body.Close()
+		return ErrorWrapper(err, "read_stream_failed", http.StatusInternalServerError), responseText.String(), usage
+	}
+
 	err := resp.Body.Close()
 	if err != nil {
-		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), "", nil
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), responseText.String(), usage
 	}
 
-	return nil, "", nil
+	return nil, responseText.String(), usage
 }
 
 func Handler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
 	for k, v := range resp.Header {
 		c.Writer.Header().Set(k, v[0])
 	}
+	// 响应体已经完整读出，长度以实际写出的为准
+	c.Writer.Header().Del("Content-Length")
 
 	c.Writer.WriteHeader(resp.StatusCode)
 
-	_, err := io.Copy(c.Writer, resp.Body)
+	_, err = c.Writer.Write(responseBody)
 	if err != nil {
-		return ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError), nil
+		return ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
 	}
 
-	err = resp.Body.Close()
+	// 透传响应的同时解析出 usage 用于计费
+	var textResponse TextResponse
+	if err = json.Unmarshal(responseBody, &textResponse); err != nil {
+		return nil, nil
+	}
+
+	return nil, &textResponse.Usage
+}
+
+type errorResponse struct {
+	Error model.Error `json:"error"`
+}
+
+func ErrorHandler(resp *http.Response) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	resp.Body.Close()
+
+	var errResponse errorResponse
+	if err = json.Unmarshal(responseBody, &errResponse); err != nil || errResponse.Error.Message == "" {
+		return ErrorWrapper(fmt.Errorf("bad response status code %d: %s", resp.StatusCode, string(responseBody)), "bad_response_status_code", resp.StatusCode)
 	}
 
-	return nil, nil
+	return &model.ErrorWithStatusCode{
+		Error:      errResponse.Error,
+		StatusCode: resp.StatusCode,
+	}
 }
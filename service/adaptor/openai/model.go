@@ -20,6 +20,7 @@ type TextResponse struct {
 
 type ChatCompletionsStreamResponseChoice struct {
 	Index        int           `json:"index"`
+	Text         string        `json:"text,omitempty"` //文本补全接口的增量
 	Message      model.Message `json:"delta"`
 	FinishReason *string       `json:"finish_reason,omitempty"`
 	Logprobs     interface{}   `json:"logprobs"`
@@ -33,3 +34,14 @@ type ChatCompletionsStreamResponse struct {
 	Choices []ChatCompletionsStreamResponseChoice `json:"choices"`
 	Usage   *model.Usage                          `json:"usage,omitempty"`
 }
+
+type ImageData struct {
+	Url           string `json:"url,omitempty"`
+	B64Json       string `json:"b64_json,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
+type ImageResponse struct {
+	Created int64       `json:"created"`
+	Data    []ImageData `json:"data"`
+}
@@ -0,0 +1,493 @@
+package openai
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/common"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/responses
+
+type ResponsesTextFormat struct {
+	Type        string         `json:"type"` //text json_object json_schema
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+type ResponsesText struct {
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
+type ResponsesReasoning struct {
+	Effort *string `json:"effort,omitempty"`
+}
+
+type ResponsesTool struct {
+	Type        string `json:"type"` //function 以及 web_search 等内置工具
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Strict      *bool  `json:"strict,omitempty"`
+}
+
+type ResponsesRequest struct {
+	Model              string              `json:"model"`
+	Input              json.RawMessage     `json:"input,omitempty"` //字符串或者输入项数组
+	Instructions       string              `json:"instructions,omitempty"`
+	PreviousResponseId string              `json:"previous_response_id,omitempty"`
+	Store              *bool               `json:"store,omitempty"` //默认保存
+	Stream             bool                `json:"stream,omitempty"`
+	Tools              []ResponsesTool     `json:"tools,omitempty"`
+	ToolChoice         any                 `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	MaxOutputTokens    int                 `json:"max_output_tokens,omitempty"`
+	Temperature        *float64            `json:"temperature,omitempty"`
+	TopP               *float64            `json:"top_p,omitempty"`
+	Text               *ResponsesText      `json:"text,omitempty"`
+	Reasoning          *ResponsesReasoning `json:"reasoning,omitempty"`
+	User               string              `json:"user,omitempty"`
+	Metadata           any                 `json:"metadata,omitempty"`
+}
+
+// InputItems input 为字符串时相当于一条用户消息
+func (r *ResponsesRequest) InputItems() ([]json.RawMessage, error) {
+	if len(r.Input) == 0 {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(r.Input, &text); err == nil {
+		item, _ := json.Marshal(map[string]any{"type": "message", "role": model.RoleUser, "content": text})
+		return []json.RawMessage{item}, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(r.Input, &items); err != nil {
+		return nil, fmt.Errorf("input must be a string or an array: %w", err)
+	}
+	return items, nil
+}
+
+type ResponsesInputContent struct {
+	Type     string `json:"type"` //input_text output_text input_image refusal
+	Text     string `json:"text"`
+	Refusal  string `json:"refusal"`
+	ImageUrl string `json:"image_url"`
+	Detail   string `json:"detail"`
+}
+
+type ResponsesInputItem struct {
+	Type      string          `json:"type"` //message function_call function_call_output reasoning，省略时为 message
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"` //字符串或者内容数组
+	CallId    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"` //字符串或者内容数组
+}
+
+type ResponsesOutputContent struct {
+	Type        string `json:"type"` //output_text
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+// ResponsesOutputItem 转换对话接口的响应时生成的输出项
+type ResponsesOutputItem struct {
+	Type      string //message function_call
+	Id        string
+	Status    string //in_progress completed incomplete
+	Content   []ResponsesOutputContent
+	CallId    string
+	Name      string
+	Arguments string
+}
+
+// MarshalJSON 不同类型的输出项字段不同，但各自的字段都是必有的
+func (i *ResponsesOutputItem) MarshalJSON() ([]byte, error) {
+	if i.Type == "function_call" {
+		return json.Marshal(map[string]any{
+			"type":      i.Type,
+			"id":        i.Id,
+			"status":    i.Status,
+			"call_id":   i.CallId,
+			"name":      i.Name,
+			"arguments": i.Arguments,
+		})
+	}
+	content := i.Content
+	if content == nil {
+		content = []ResponsesOutputContent{}
+	}
+	return json.Marshal(map[string]any{
+		"type":    i.Type,
+		"id":      i.Id,
+		"status":  i.Status,
+		"role":    model.RoleAssistant,
+		"content": content,
+	})
+}
+
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+type ResponsesUsage struct {
+	InputTokens         int                          `json:"input_tokens"`
+	InputTokensDetails  ResponsesInputTokensDetails  `json:"input_tokens_details"`
+	OutputTokens        int                          `json:"output_tokens"`
+	OutputTokensDetails ResponsesOutputTokensDetails `json:"output_tokens_details"`
+	TotalTokens         int                          `json:"total_tokens"`
+}
+
+func (u *ResponsesUsage) ToUsage() *model.Usage {
+	if u == nil {
+		return nil
+	}
+	return &model.Usage{
+		PromptTokens:            u.InputTokens,
+		CompletionTokens:        u.OutputTokens,
+		TotalTokens:             u.TotalTokens,
+		PromptTokensDetails:     &model.PromptTokensDetails{CachedTokens: u.InputTokensDetails.CachedTokens},
+		CompletionTokensDetails: &model.CompletionTokensDetails{ReasoningTokens: u.OutputTokensDetails.ReasoningTokens},
+	}
+}
+
+func usageChat2Responses(usage *model.Usage) *ResponsesUsage {
+	if usage == nil {
+		return nil
+	}
+	responsesUsage := ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+	}
+	if usage.PromptTokensDetails != nil {
+		responsesUsage.InputTokensDetails.CachedTokens = usage.PromptTokensDetails.CachedTokens
+	}
+	if usage.CompletionTokensDetails != nil {
+		responsesUsage.OutputTokensDetails.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	return &responsesUsage
+}
+
+type ResponsesError struct {
+	Code    any    `json:"code"`
+	Message string `json:"message"`
+}
+
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"` //max_output_tokens content_filter
+}
+
+type ResponsesResponse struct {
+	Id                 string                      `json:"id"`
+	Object             string                      `json:"object"`
+	CreatedAt          int64                       `json:"created_at"`
+	Status             string                      `json:"status"` //in_progress completed incomplete failed
+	Error              *ResponsesError             `json:"error"`
+	IncompleteDetails  *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Instructions       string                      `json:"instructions,omitempty"`
+	MaxOutputTokens    int                         `json:"max_output_tokens,omitempty"`
+	Model              string                      `json:"model"`
+	Output             []any                       `json:"output"`
+	ParallelToolCalls  bool                        `json:"parallel_tool_calls"`
+	PreviousResponseId string                      `json:"previous_response_id,omitempty"`
+	Temperature        *float64                    `json:"temperature,omitempty"`
+	TopP               *float64                    `json:"top_p,omitempty"`
+	ToolChoice         any                         `json:"tool_choice"`
+	Tools              []ResponsesTool             `json:"tools"`
+	Usage              *ResponsesUsage             `json:"usage,omitempty"`
+	Metadata           any                         `json:"metadata,omitempty"`
+}
+
+type ResponsesStreamEvent struct {
+	Type     string             `json:"type"`
+	Response *ResponsesResponse `json:"response,omitempty"`
+}
+
+// NewResponsesId 生成 resp_ msg_ fc_ 等前缀的 id
+func NewResponsesId(prefix string) string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return prefix + "_" + hex.EncodeToString(b)
+}
+
+// responsesContent 消息内容全是文本时合并成字符串，有图片时使用 ParseContent 能解析的 []any 结构
+func responsesContent(raw json.RawMessage) (any, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var contents []ResponsesInputContent
+	if err := json.Unmarshal(raw, &contents); err != nil {
+		return nil, fmt.Errorf("invalid message content: %w", err)
+	}
+
+	var (
+		parts    []any
+		texts    []string
+		onlyText = true
+	)
+	for _, content := range contents {
+		switch content.Type {
+		case "input_text", "output_text", "refusal":
+			if content.Type == "refusal" {
+				content.Text = content.Refusal
+			}
+			texts = append(texts, content.Text)
+			parts = append(parts, map[string]any{"type": model.ContentTypeText, "text": content.Text})
+		case "input_image":
+			if content.ImageUrl == "" {
+				return nil, fmt.Errorf("input_image without image_url is not supported")
+			}
+			onlyText = false
+			imageURL := map[string]any{"url": content.ImageUrl}
+			if content.Detail != "" {
+				imageURL["detail"] = content.Detail
+			}
+			parts = append(parts, map[string]any{"type": model.ContentTypeImageURL, "image_url": imageURL})
+		default:
+			return nil, fmt.Errorf("unsupported content type: %s", content.Type)
+		}
+	}
+	if onlyText {
+		return strings.Join(texts, "\n"), nil
+	}
+	return parts, nil
+}
+
+// outputText function_call_output 的 output 可以是字符串或者内容数组，只保留文本
+func outputText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var contents []ResponsesInputContent
+	json.Unmarshal(raw, &contents)
+	var texts []string
+	for _, content := range contents {
+		if content.Text != "" {
+			texts = append(texts, content.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ConvertResponsesRequest 把 /v1/responses 的请求转换成对话请求，items 为包含历史的完整输入项。
+// 遇到对话接口无法表达的内容（内置工具、文件等）时仍然返回转换结果，同时返回错误，透传时只用转换结果预估 token
+func ConvertResponsesRequest(request *ResponsesRequest, items []json.RawMessage) (*model.GeneralOpenAIRequest, error) {
+	textRequest := model.GeneralOpenAIRequest{
+		Model:            request.Model,
+		Stream:           request.Stream,
+		MaxTokens:        request.MaxOutputTokens,
+		Temperature:      request.Temperature,
+		TopP:             request.TopP,
+		ParallelTooCalls: request.ParallelToolCalls,
+		User:             request.User,
+	}
+	if request.Reasoning != nil {
+		textRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+	if request.Text != nil && request.Text.Format != nil {
+		switch format := request.Text.Format; format.Type {
+		case "json_object":
+			textRequest.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+		case "json_schema":
+			textRequest.ResponseFormat = &model.ResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &model.JSONSchema{
+					Name:        format.Name,
+					Description: format.Description,
+					Schema:      format.Schema,
+					Strict:      format.Strict,
+				},
+			}
+		}
+	}
+
+	var unsupported error
+	for _, tool := range request.Tools {
+		if tool.Type != model.ToolTypeFunction {
+			if unsupported == nil {
+				unsupported = fmt.Errorf("unsupported tool type: %s", tool.Type)
+			}
+			continue
+		}
+		textRequest.Tools = append(textRequest.Tools, model.Tool{
+			Type: model.ToolTypeFunction,
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	// tool_choice 指定函数时为 {"type": "function", "name": "..."}
+	switch toolChoice := request.ToolChoice.(type) {
+	case string:
+		textRequest.ToolChoice = toolChoice
+	case map[string]any:
+		if name, ok := toolChoice["name"].(string); ok && toolChoice["type"] == model.ToolTypeFunction {
+			textRequest.ToolChoice = map[string]any{
+				"type":     model.ToolTypeFunction,
+				"function": map[string]any{"name": name},
+			}
+		}
+	}
+
+	if request.Instructions != "" {
+		textRequest.Messages = append(textRequest.Messages, model.Message{
+			Role:    model.RoleSystem,
+			Content: request.Instructions,
+		})
+	}
+
+	for _, raw := range items {
+		var item ResponsesInputItem
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, fmt.Errorf("invalid input item: %w", err)
+		}
+		switch item.Type {
+		case "", "message":
+			content, err := responsesContent(item.Content)
+			if err != nil {
+				if unsupported == nil {
+					unsupported = err
+				}
+				continue
+			}
+			textRequest.Messages = append(textRequest.Messages, model.Message{
+				Role:    item.Role,
+				Content: content,
+			})
+		case "function_call":
+			toolCall := model.ToolCall{
+				Id:   item.CallId,
+				Type: model.ToolTypeFunction,
+				Function: model.FunctionCall{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			// 连续的函数调用属于同一条助手消息
+			if n := len(textRequest.Messages); n > 0 && textRequest.Messages[n-1].Role == model.RoleAssistant {
+				textRequest.Messages[n-1].ToolCalls = append(textRequest.Messages[n-1].ToolCalls, toolCall)
+				continue
+			}
+			textRequest.Messages = append(textRequest.Messages, model.Message{
+				Role:      model.RoleAssistant,
+				ToolCalls: []model.ToolCall{toolCall},
+			})
+		case "function_call_output":
+			textRequest.Messages = append(textRequest.Messages, model.Message{
+				Role:       model.RoleTool,
+				ToolCallId: item.CallId,
+				Content:    outputText(item.Output),
+			})
+		case "reasoning":
+			// 推理内容不回传给上游
+		default:
+			if unsupported == nil {
+				unsupported = fmt.Errorf("unsupported input item type: %s", item.Type)
+			}
+		}
+	}
+
+	return &textRequest, unsupported
+}
+
+// replaceResponseId 把上游的响应 id 换成网关生成的 id。
+// 上游不保存对话，不同渠道返回的 id 可能重复，网关保存的响应只使用自己生成的 id
+func replaceResponseId(data, upstreamId, id string) string {
+	if upstreamId == "" {
+		return data
+	}
+	return strings.ReplaceAll(data, `"`+upstreamId+`"`, `"`+id+`"`)
+}
+
+// ResponsesHandler 透传上游 /v1/responses 的响应，响应 id 换成网关生成的，同时解析出响应对象用于计费和保存
+func ResponsesHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *ResponsesResponse) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	var response ResponsesResponse
+	if err = json.Unmarshal(responseBody, &response); err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	id := NewResponsesId("resp")
+	responseBody = []byte(replaceResponseId(string(responseBody), response.Id, id))
+	response.Id = id
+
+	c.Data(http.StatusOK, "application/json", responseBody)
+	return nil, &response
+}
+
+// ResponsesStreamHandler 逐行透传上游的事件流，响应 id 换成网关生成的，从 response.completed 等结束事件中取出完整的响应对象
+func ResponsesStreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *ResponsesResponse) {
+	common.SetEventStreamHeaders(c)
+
+	var (
+		response   *ResponsesResponse
+		upstreamId string
+		id         = NewResponsesId("resp")
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var event ResponsesStreamEvent
+		if strings.HasPrefix(line, dataPrefix) && json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, dataPrefix))), &event) == nil && event.Response != nil {
+			// response.created 是第一个事件，之后的事件都带同一个响应 id
+			if upstreamId == "" {
+				upstreamId = event.Response.Id
+			}
+			switch event.Type {
+			case "response.completed", "response.incomplete", "response.failed":
+				response = event.Response
+				response.Id = id
+			}
+		}
+		c.Writer.WriteString(replaceResponseId(line, upstreamId, id) + "\n")
+		// 空行是一个事件的结束
+		if line == "" {
+			c.Writer.Flush()
+		}
+	}
+	c.Writer.Flush()
+
+	if err := scanner.Err(); err != nil {
+		return ErrorWrapper(err, "read_stream_failed", http.StatusInternalServerError), response
+	}
+
+	err := resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), response
+	}
+
+	return nil, response
+}
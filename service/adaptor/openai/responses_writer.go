@@ -0,0 +1,330 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+)
+
+// ResponsesWriter 把对话接口的响应转换成 /v1/responses 的格式，用于不支持 Responses API 的上游。
+// 非流式响应在 Finish 时整体转换；流式响应转换成 response.* 事件后立即写出
+type ResponsesWriter struct {
+	*TranscodeWriter
+	meta     *meta.Meta
+	stream   bool
+	response ResponsesResponse
+
+	// 流式响应的状态
+	started      bool
+	sequence     int
+	message      int         //当前打开的消息在 output 中的位置，-1 表示没有
+	toolItems    map[int]int //OpenAI 工具调用的 index -> output 中的位置，上游可能交替返回多个工具调用的参数，函数调用在结束时才关闭
+	finishReason string
+	usage        *model.Usage
+}
+
+func NewResponsesWriter(c *gin.Context, meta *meta.Meta, request *ResponsesRequest) *ResponsesWriter {
+	w := &ResponsesWriter{
+		meta:   meta,
+		stream: request.Stream,
+		response: ResponsesResponse{
+			Id:                 NewResponsesId("resp"),
+			Object:             "response",
+			CreatedAt:          time.Now().Unix(),
+			Status:             "in_progress",
+			Instructions:       request.Instructions,
+			MaxOutputTokens:    request.MaxOutputTokens,
+			Model:              request.Model,
+			Output:             []any{},
+			ParallelToolCalls:  request.ParallelToolCalls == nil || *request.ParallelToolCalls,
+			PreviousResponseId: request.PreviousResponseId,
+			Temperature:        request.Temperature,
+			TopP:               request.TopP,
+			ToolChoice:         request.ToolChoice,
+			Tools:              request.Tools,
+			Metadata:           request.Metadata,
+		},
+		message:   -1,
+		toolItems: make(map[int]int),
+	}
+	if w.response.ToolChoice == nil {
+		w.response.ToolChoice = "auto"
+	}
+	if w.response.Tools == nil {
+		w.response.Tools = []ResponsesTool{}
+	}
+	w.TranscodeWriter = NewTranscodeWriter(c.Writer, request.Stream, w.handleLine)
+	c.Writer = w
+	return w
+}
+
+// Response 转发成功时返回完整的响应对象，用于保存
+func (w *ResponsesWriter) Response() *ResponsesResponse {
+	if w.response.Status == "in_progress" || w.response.Status == "failed" {
+		return nil
+	}
+	return &w.response
+}
+
+// Finish 转发结束后调用，relayErr 为转发流程返回的错误
+func (w *ResponsesWriter) Finish(relayErr *model.ErrorWithStatusCode) {
+	if w.stream && w.started {
+		// 上游在 [DONE] 之后仍可能返回读取错误，response.completed 等转发结果确定后再输出
+		if relayErr != nil {
+			w.response.Status = "failed"
+			w.response.Error = &ResponsesError{Code: relayErr.Code, Message: relayErr.Message}
+			w.event("response.failed", map[string]any{"response": &w.response})
+			return
+		}
+		w.finish()
+		return
+	}
+
+	if relayErr != nil {
+		w.writeJSON(relayErr.StatusCode, gin.H{"error": relayErr.Error})
+		return
+	}
+
+	if w.stream {
+		// 上游没有返回任何内容
+		w.finish()
+		return
+	}
+
+	var textResponse TextResponse
+	if err := json.Unmarshal(w.Body(), &textResponse); err != nil {
+		w.writeJSON(http.StatusInternalServerError, gin.H{"error": ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError).Error})
+		return
+	}
+	var finishReason string
+	if len(textResponse.Choices) > 0 {
+		choice := textResponse.Choices[0]
+		finishReason = choice.FinishReason
+		if text := choice.Message.StringContent(); text != "" {
+			w.response.Output = append(w.response.Output, &ResponsesOutputItem{
+				Type:    "message",
+				Id:      NewResponsesId("msg"),
+				Status:  "completed",
+				Content: []ResponsesOutputContent{{Type: "output_text", Text: text, Annotations: []any{}}},
+			})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			w.response.Output = append(w.response.Output, &ResponsesOutputItem{
+				Type:      "function_call",
+				Id:        NewResponsesId("fc"),
+				Status:    "completed",
+				CallId:    toolCall.Id,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			})
+		}
+	}
+	w.complete(finishReason, &textResponse.Usage)
+	w.writeJSON(http.StatusOK, &w.response)
+}
+
+// complete 根据结束原因设置响应状态
+func (w *ResponsesWriter) complete(finishReason string, usage *model.Usage) {
+	w.response.Status = "completed"
+	switch finishReason {
+	case "length":
+		w.response.Status = "incomplete"
+		w.response.IncompleteDetails = &ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		w.response.Status = "incomplete"
+		w.response.IncompleteDetails = &ResponsesIncompleteDetails{Reason: "content_filter"}
+	}
+	w.response.Usage = usageChat2Responses(usage)
+}
+
+func (w *ResponsesWriter) writeJSON(code int, v any) {
+	jsonData, _ := json.Marshal(v)
+	header := w.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(code)
+	w.ResponseWriter.Write(jsonData)
+}
+
+// event 每个事件都带有 type 和递增的 sequence_number
+func (w *ResponsesWriter) event(eventType string, data map[string]any) {
+	if !w.ResponseWriter.Written() {
+		w.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	data["type"] = eventType
+	data["sequence_number"] = w.sequence
+	w.sequence++
+	jsonData, _ := json.Marshal(data)
+	fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", eventType, jsonData)
+	w.ResponseWriter.Flush()
+}
+
+func (w *ResponsesWriter) handleLine(line string) {
+	if !strings.HasPrefix(line, dataPrefix) {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, dataPrefix))
+	if data == "[DONE]" {
+		return
+	}
+
+	var chunk ChatCompletionsStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return
+	}
+	w.start()
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		w.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			if w.message < 0 {
+				w.message = w.openItem(&ResponsesOutputItem{Type: "message", Id: NewResponsesId("msg"), Status: "in_progress"})
+				item := w.outputItem(w.message)
+				w.event("response.content_part.added", map[string]any{
+					"item_id":       item.Id,
+					"output_index":  w.message,
+					"content_index": 0,
+					"part":          ResponsesOutputContent{Type: "output_text", Annotations: []any{}},
+				})
+				item.Content = []ResponsesOutputContent{{Type: "output_text", Annotations: []any{}}}
+			}
+			item := w.outputItem(w.message)
+			item.Content[0].Text += text
+			w.event("response.output_text.delta", map[string]any{
+				"item_id":       item.Id,
+				"output_index":  w.message,
+				"content_index": 0,
+				"delta":         text,
+			})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			index := 0
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			outputIndex, ok := w.toolItems[index]
+			if !ok {
+				outputIndex = w.openItem(&ResponsesOutputItem{
+					Type:   "function_call",
+					Id:     NewResponsesId("fc"),
+					Status: "in_progress",
+					CallId: toolCall.Id,
+					Name:   toolCall.Function.Name,
+				})
+				w.toolItems[index] = outputIndex
+			}
+			if toolCall.Function.Arguments != "" {
+				item := w.outputItem(outputIndex)
+				item.Arguments += toolCall.Function.Arguments
+				w.event("response.function_call_arguments.delta", map[string]any{
+					"item_id":      item.Id,
+					"output_index": outputIndex,
+					"delta":        toolCall.Function.Arguments,
+				})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = *choice.FinishReason
+		}
+	}
+}
+
+func (w *ResponsesWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.event("response.created", map[string]any{"response": &w.response})
+	w.event("response.in_progress", map[string]any{"response": &w.response})
+}
+
+// openItem 打开新的输出项前先关闭消息，返回新输出项在 output 中的位置
+func (w *ResponsesWriter) openItem(item *ResponsesOutputItem) int {
+	w.closeMessage()
+	w.response.Output = append(w.response.Output, item)
+	outputIndex := len(w.response.Output) - 1
+	w.event("response.output_item.added", map[string]any{
+		"output_index": outputIndex,
+		"item":         item,
+	})
+	return outputIndex
+}
+
+func (w *ResponsesWriter) outputItem(outputIndex int) *ResponsesOutputItem {
+	return w.response.Output[outputIndex].(*ResponsesOutputItem)
+}
+
+func (w *ResponsesWriter) closeMessage() {
+	if w.message < 0 {
+		return
+	}
+	w.closeItem(w.message)
+	w.message = -1
+}
+
+func (w *ResponsesWriter) closeItem(outputIndex int) {
+	item := w.outputItem(outputIndex)
+	item.Status = "completed"
+	switch item.Type {
+	case "message":
+		w.event("response.output_text.done", map[string]any{
+			"item_id":       item.Id,
+			"output_index":  outputIndex,
+			"content_index": 0,
+			"text":          item.Content[0].Text,
+		})
+		w.event("response.content_part.done", map[string]any{
+			"item_id":       item.Id,
+			"output_index":  outputIndex,
+			"content_index": 0,
+			"part":          item.Content[0],
+		})
+	case "function_call":
+		w.event("response.function_call_arguments.done", map[string]any{
+			"item_id":      item.Id,
+			"output_index": outputIndex,
+			"arguments":    item.Arguments,
+		})
+	}
+	w.event("response.output_item.done", map[string]any{
+		"output_index": outputIndex,
+		"item":         item,
+	})
+}
+
+// finish 上游的 usage 在 finish_reason 之后才返回，转发成功结束后再输出 response.completed
+func (w *ResponsesWriter) finish() {
+	w.start()
+	w.closeMessage()
+	items := make([]int, 0, len(w.toolItems))
+	for _, outputIndex := range w.toolItems {
+		items = append(items, outputIndex)
+	}
+	sort.Ints(items)
+	for _, outputIndex := range items {
+		w.closeItem(outputIndex)
+	}
+
+	usage := w.usage
+	if usage == nil {
+		usage = &model.Usage{PromptTokens: w.meta.PromptTokens}
+	}
+	w.complete(w.finishReason, usage)
+	if w.response.Status == "incomplete" {
+		w.event("response.incomplete", map[string]any{"response": &w.response})
+		return
+	}
+	w.event("response.completed", map[string]any{"response": &w.response})
+}
@@ -0,0 +1,16 @@
+package openai
+
+import (
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/tokenizer"
+)
+
+// ResponseText2Usage 上游没有返回 usage 时，根据输出的文本估算
+func ResponseText2Usage(responseText string, modelName string, promptTokens int) *model.Usage {
+	usage := &model.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: tokenizer.CountTokenText(responseText, modelName),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
@@ -0,0 +1,59 @@
+package openai
+
+import (
+	"strings"
+
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+)
+
+// 上游返回的 index 最多比已有的调用数大 maxToolIndexGap，超出范围的增量不再合并，避免异常的 index 占用大量内存
+const maxToolIndexGap = 8
+
+// toolCallCollector 合并流式响应中工具调用的增量，同一个调用的参数会分多个块返回
+type toolCallCollector struct {
+	toolCalls []*model.ToolCall
+}
+
+// add 合并一个块中的工具调用增量，有的上游不返回 index，此时补上 index，返回是否有补充
+func (t *toolCallCollector) add(deltas []model.ToolCall) bool {
+	patched := false
+	for i := range deltas {
+		delta := &deltas[i]
+		if delta.Index == nil {
+			// 带 id 的是一个新的调用，否则是上一个调用的后续参数
+			index := len(t.toolCalls) - 1
+			if delta.Id != "" || index < 0 {
+				index = len(t.toolCalls)
+			}
+			delta.Index = &index
+			patched = true
+		}
+
+		index := *delta.Index
+		if index < 0 || index > len(t.toolCalls)+maxToolIndexGap {
+			continue
+		}
+		for len(t.toolCalls) <= index {
+			t.toolCalls = append(t.toolCalls, &model.ToolCall{Type: model.ToolTypeFunction})
+		}
+		toolCall := t.toolCalls[index]
+		if delta.Id != "" {
+			toolCall.Id = delta.Id
+		}
+		if delta.Function.Name != "" {
+			toolCall.Function.Name = delta.Function.Name
+		}
+		toolCall.Function.Arguments += delta.Function.Arguments
+	}
+	return patched
+}
+
+// text 工具调用的函数名和参数也计入输出的 token
+func (t *toolCallCollector) text() string {
+	var builder strings.Builder
+	for _, toolCall := range t.toolCalls {
+		builder.WriteString(toolCall.Function.Name)
+		builder.WriteString(toolCall.Function.Arguments)
+	}
+	return builder.String()
+}
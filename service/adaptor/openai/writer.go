@@ -0,0 +1,66 @@
+package openai
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TranscodeWriter 截获转发流程写出的 OpenAI 格式响应，供其它协议的入站接口转换格式。
+// 非流式响应整体缓存，由调用方在转发结束后读取 Body 转换；流式响应按行回调 onLine
+type TranscodeWriter struct {
+	gin.ResponseWriter
+	stream  bool
+	written bool
+	buf     bytes.Buffer
+	onLine  func(line string)
+}
+
+func NewTranscodeWriter(w gin.ResponseWriter, stream bool, onLine func(line string)) *TranscodeWriter {
+	return &TranscodeWriter{
+		ResponseWriter: w,
+		stream:         stream,
+		onLine:         onLine,
+	}
+}
+
+// WriteHeader 状态码在真正写出时再设置，错误由调用方按各自的协议返回
+func (w *TranscodeWriter) WriteHeader(code int) {
+	w.written = true
+}
+
+func (w *TranscodeWriter) WriteHeaderNow() {}
+
+func (w *TranscodeWriter) Written() bool {
+	return w.written
+}
+
+func (w *TranscodeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *TranscodeWriter) Write(data []byte) (int, error) {
+	w.written = true
+	w.buf.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+
+	// 只处理完整的行，剩余部分留到下次
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			break
+		}
+		w.onLine(strings.TrimSpace(line))
+	}
+	return len(data), nil
+}
+
+// Body 非流式响应的完整内容
+func (w *TranscodeWriter) Body() []byte {
+	return w.buf.Bytes()
+}
@@ -0,0 +1,66 @@
+package whisper
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaoxiongmao5/we-api/meta"
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+	"github.com/xiaoxiongmao5/we-api/service/adaptor/openai"
+)
+
+// Adaptor 对接 whisper.cpp 的 server，只支持转写和翻译
+// https://github.com/ggerganov/whisper.cpp/tree/master/examples/server
+type Adaptor struct {
+	contentType string
+}
+
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	switch meta.Mode {
+	case relaymode.AudioTranscription, relaymode.AudioTranslation:
+		return meta.BaseURL + "/inference", nil
+	}
+	return "", errors.New("whisper only supports audio transcription")
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	if meta.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	}
+	req.Header.Set("Content-Type", a.contentType)
+
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, meta *meta.Meta, request *model.GeneralOpenAIRequest) (any, error) {
+	return nil, errors.New("whisper does not support chat")
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	return nil, errors.New("whisper does not support image generation")
+}
+
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, request *model.AudioRequest) (io.Reader, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+
+	body, contentType, err := openai.BuildAudioForm(request.File, request.FileName, convertFields(meta.Mode, *request))
+	if err != nil {
+		return nil, err
+	}
+	a.contentType = contentType
+	return body, nil
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, openai.ErrorHandler(resp)
+	}
+
+	err, usage = openai.AudioHandler(c, resp)
+	return
+}
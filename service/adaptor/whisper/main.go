@@ -0,0 +1,28 @@
+package whisper
+
+import (
+	"net/url"
+
+	"github.com/xiaoxiongmao5/we-api/relay/model"
+	"github.com/xiaoxiongmao5/we-api/relay/relaymode"
+)
+
+// whisper.cpp 的 /inference 与 OpenAI 的表单字段基本一致，模型在启动时指定，翻译通过 translate 字段开启
+var supportedFields = []string{"language", "prompt", "temperature"}
+
+func convertFields(mode string, request model.AudioRequest) url.Values {
+	fields := make(url.Values, len(supportedFields)+2)
+	for _, k := range supportedFields {
+		if values, ok := request.Fields[k]; ok {
+			fields[k] = values
+		}
+	}
+	fields.Set("response_format", request.ResponseFormat)
+	if request.ResponseFormat == "" {
+		fields.Set("response_format", "json")
+	}
+	if mode == relaymode.AudioTranslation {
+		fields.Set("translate", "true")
+	}
+	return fields
+}
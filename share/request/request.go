@@ -29,8 +29,8 @@ type FetchOpts struct {
 	// TmOut     time.Duration          `json:"-"`
 }
 
-func Fetch[T interface{}](reqOpts FetchOpts) (*T, error) {
-	ctx := context.Background()
+// Fetch 发送请求并解析 json 响应，ctx 取消时请求随之中断
+func Fetch[T interface{}](ctx context.Context, reqOpts FetchOpts) (*T, error) {
 	logger := utils.Logf(ctx, "Fetch")
 
 	uri := reqOpts.Host + reqOpts.Url
@@ -108,16 +108,11 @@ func Fetch[T interface{}](reqOpts FetchOpts) (*T, error) {
 	return ret, nil
 }
 
-func FetchStream[T interface{}](reqOpts FetchOpts, resChan chan *T, errChan chan error) {
+// FetchStream 发送请求并按行解析 SSE 响应，结束时关闭 resChan 和 errChan，出错时先把错误写入 errChan。
+// ctx 取消时中断读取，调用方不再接收时也不会阻塞
+func FetchStream[T interface{}](ctx context.Context, reqOpts FetchOpts, resChan chan *T, errChan chan error) {
 	var err error
-	defer func() {
-		errChan <- err
-		close(errChan)
-		if _, ok := <-resChan; ok {
-			close(resChan)
-		}
-	}()
-	ctx := context.Background()
+	defer func() { finish(ctx, resChan, errChan, err) }()
 	logger := utils.Logf(ctx, "FetchStream")
 
 	uri := reqOpts.Host + reqOpts.Url
@@ -146,7 +141,8 @@ func FetchStream[T interface{}](reqOpts FetchOpts, resChan chan *T, errChan chan
 	}
 
 	if reqOpts.Method == "POST" {
-		jsonData, err := json.Marshal(reqOpts.PostData)
+		var jsonData []byte
+		jsonData, err = json.Marshal(reqOpts.PostData)
 		if err != nil {
 			logger.Error("json.Marshal(reqOpts.PostData) error", xlog.Err(err))
 			return
@@ -159,13 +155,12 @@ func FetchStream[T interface{}](reqOpts FetchOpts, resChan chan *T, errChan chan
 	startTime := time.Now().Unix()
 
 	res, err := reqIns.SetContext(ctx).Execute(reqOpts.Method, uri)
-	defer res.RawBody().Close() //关闭响应体
-
 	if err != nil {
 		logger.Error("request error", xlog.Err(err),
 			xlog.String("uri", uri))
 		return
 	}
+	defer res.RawBody().Close() //关闭响应体
 
 	if statusCode := res.StatusCode(); statusCode != http.StatusOK && statusCode != http.StatusCreated {
 		logger.Error("request error: request status is not 200",
@@ -179,22 +174,23 @@ func FetchStream[T interface{}](reqOpts FetchOpts, resChan chan *T, errChan chan
 	reader := bufio.NewReader(res.RawBody()) // 使用 bufio.Reader 方便按行读取 (如果流是按行分隔的，例如 SSE)
 
 	for {
-		line, err := reader.ReadBytes('\n') // 按行读取，可根据实际流格式调整分隔符
+		var line []byte
+		line, err = reader.ReadBytes('\n') // 按行读取，可根据实际流格式调整分隔符
 		if err != nil {
 			// 计算请求执行时间
 			execTime := time.Now().Unix() - startTime
 			if err == io.EOF { // 流结束
-				close(resChan)
+				err = nil
 				logger.Info("Stream finished",
 					xlog.String("uri", uri),
 					xlog.Int64("execTime", execTime))
-				break
+				return
 			}
-			// 读取错误
+			// 读取错误，调用方断开连接时也会中断读取
 			logger.Error("reading stream error", xlog.Err(err),
 				xlog.String("uri", uri),
 				xlog.Int64("execTime", execTime))
-			break
+			return
 		}
 
 		// 处理每一行数据 (流式处理的核心逻辑)
@@ -204,7 +200,6 @@ func FetchStream[T interface{}](reqOpts FetchOpts, resChan chan *T, errChan chan
 			continue
 		}
 		if strings.HasPrefix(string(line), "[DONE]") {
-			close(resChan)
 			logger.Info("Stream finished", xlog.String("uri", uri))
 			return
 		}
@@ -216,23 +211,20 @@ func FetchStream[T interface{}](reqOpts FetchOpts, resChan chan *T, errChan chan
 			logger.Error("stream data json.Unmarshal error", xlog.Err(err),
 				xlog.String("uri", uri))
 			return
-		} else {
-			resChan <- ret
 		}
-
+		select {
+		case resChan <- ret:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
 	}
 }
 
-func FetchStreamBase(reqOpts FetchOpts, resChan chan []byte, errChan chan error) {
+// FetchStreamBase 同 FetchStream，按行原样返回响应
+func FetchStreamBase(ctx context.Context, reqOpts FetchOpts, resChan chan []byte, errChan chan error) {
 	var err error
-	defer func() {
-		errChan <- err
-		close(errChan)
-		if _, ok := <-resChan; ok {
-			close(resChan)
-		}
-	}()
-	ctx := context.Background()
+	defer func() { finish(ctx, resChan, errChan, err) }()
 	logger := utils.Logf(ctx, "FetchStream")
 
 	uri := reqOpts.Host + reqOpts.Url
@@ -261,7 +253,8 @@ func FetchStreamBase(reqOpts FetchOpts, resChan chan []byte, errChan chan error)
 	}
 
 	if reqOpts.Method == "POST" {
-		jsonData, err := json.Marshal(reqOpts.PostData)
+		var jsonData []byte
+		jsonData, err = json.Marshal(reqOpts.PostData)
 		if err != nil {
 			logger.Error("json.Marshal(reqOpts.PostData) error", xlog.Err(err))
 			return
@@ -274,13 +267,12 @@ func FetchStreamBase(reqOpts FetchOpts, resChan chan []byte, errChan chan error)
 	startTime := time.Now().Unix()
 
 	res, err := reqIns.SetContext(ctx).Execute(reqOpts.Method, uri)
-	defer res.RawBody().Close() //关闭响应体
-
 	if err != nil {
 		logger.Error("request error", xlog.Err(err),
 			xlog.String("uri", uri))
 		return
 	}
+	defer res.RawBody().Close() //关闭响应体
 
 	if statusCode := res.StatusCode(); statusCode != http.StatusOK && statusCode != http.StatusCreated {
 		logger.Error("request error: request status is not 200",
@@ -294,28 +286,46 @@ func FetchStreamBase(reqOpts FetchOpts, resChan chan []byte, errChan chan error)
 	reader := bufio.NewReader(res.RawBody()) // 使用 bufio.Reader 方便按行读取 (如果流是按行分隔的，例如 SSE)
 
 	for {
-		line, err := reader.ReadBytes('\n') // 按行读取，可根据实际流格式调整分隔符
+		var line []byte
+		line, err = reader.ReadBytes('\n') // 按行读取，可根据实际流格式调整分隔符
 		if err != nil {
 			// 计算请求执行时间
 			execTime := time.Now().Unix() - startTime
 			if err == io.EOF { // 流结束
-				close(resChan)
+				err = nil
 				logger.Info("Stream finished",
 					xlog.String("uri", uri),
 					xlog.Int64("execTime", execTime))
-				break
+				return
 			}
-			// 读取错误
+			// 读取错误，调用方断开连接时也会中断读取
 			logger.Error("reading stream error", xlog.Err(err),
 				xlog.String("uri", uri),
 				xlog.Int64("execTime", execTime))
-			break
+			return
 		}
 
 		// 处理每一行数据 (流式处理的核心逻辑)
 		logger.Info("stream data", xlog.String("line", string(line)))
-		resChan <- line
+		select {
+		case resChan <- line:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+}
+
+// finish 结束流式请求，出错时先把错误交给调用方。调用方已经断开时不再等待接收
+func finish[T any](ctx context.Context, resChan chan T, errChan chan error, err error) {
+	if err != nil {
+		select {
+		case errChan <- err:
+		case <-ctx.Done():
+		}
 	}
+	close(resChan)
+	close(errChan)
 }
 
 func mapInterfaceToMapString(m map[string]interface{}) map[string]string {
@@ -0,0 +1,68 @@
+package store
+
+import "errors"
+
+var ErrInsufficientQuota = errors.New("insufficient quota")
+
+func findToken(id int) *Token {
+	for _, token := range db.Tokens {
+		if token.Id == id {
+			return token
+		}
+	}
+	return nil
+}
+
+// PreConsumeQuota 请求上游之前按预估值同时扣减令牌和用户的额度，任意一方不足时不扣减
+func PreConsumeQuota(tokenId int, userId int, quota int64) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	token := findToken(tokenId)
+	user := findUser(userId)
+	if token == nil || user == nil {
+		return ErrNotFound
+	}
+	if !token.UnlimitedQuota && token.RemainQuota < quota {
+		return ErrInsufficientQuota
+	}
+	if !user.UnlimitedQuota && user.Quota < quota {
+		return ErrInsufficientQuota
+	}
+
+	consume(token, user, quota)
+	dirty = true
+	return nil
+}
+
+// AdjustQuota 按实际用量结算，delta 为实际额度与预扣额度的差值，为负数时退还
+func AdjustQuota(tokenId int, userId int, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	token := findToken(tokenId)
+	user := findUser(userId)
+	if token == nil || user == nil {
+		return ErrNotFound
+	}
+
+	// 结算时不再校验余额，允许最后一次请求把额度扣成负数
+	consume(token, user, delta)
+	dirty = true
+	return nil
+}
+
+func consume(token *Token, user *User, quota int64) {
+	if !token.UnlimitedQuota {
+		token.RemainQuota -= quota
+	}
+	token.UsedQuota += quota
+	if !user.UnlimitedQuota {
+		user.Quota -= quota
+	}
+	user.UsedQuota += quota
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+/*
+[INFO] /v1/responses 的响应保存在数据库文件同级的 responses 目录中，每个响应一个文件。
+响应中可能带有图片等大段内容，不放进主数据库文件，避免每次修改都整体写回。
+每个响应只保存本轮的输入项和输出项，通过 previous_response_id 串起完整的对话。
+*/
+
+const (
+	responseDir = "responses"
+	// 与 OpenAI 一致，响应保存 30 天
+	responseTTL = 30 * 24 * time.Hour
+	// 防止异常数据导致无限追溯
+	maxResponseChain = 1000
+)
+
+var responseIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type Response struct {
+	Id                 string            `json:"id"`
+	UserId             int               `json:"user_id"`
+	PreviousResponseId string            `json:"previous_response_id,omitempty"`
+	Input              []json.RawMessage `json:"input"`  //本轮的输入项
+	Output             []json.RawMessage `json:"output"` //本轮的输出项
+	Body               json.RawMessage   `json:"body"`   //返回给调用方的响应对象
+	CreatedAt          int64             `json:"created_at"`
+}
+
+func responsePath(id string) (string, error) {
+	if !responseIdPattern.MatchString(id) {
+		return "", ErrNotFound
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return filepath.Join(filepath.Dir(path), responseDir, id+".json"), nil
+}
+
+func SaveResponse(response *Response) error {
+	filePath, err := responsePath(response.Id)
+	if err != nil {
+		return err
+	}
+	if response.CreatedAt == 0 {
+		response.CreatedAt = time.Now().Unix()
+	}
+	content, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	tmpPath := filePath + ".tmp"
+	if err = os.WriteFile(tmpPath, content, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+// GetResponse 只能读取自己的响应，过期的响应会被删除
+func GetResponse(id string, userId int) (*Response, error) {
+	filePath, err := responsePath(id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var response Response
+	if err = json.Unmarshal(content, &response); err != nil {
+		return nil, err
+	}
+	if response.UserId != userId {
+		return nil, ErrNotFound
+	}
+	if time.Since(time.Unix(response.CreatedAt, 0)) > responseTTL {
+		os.Remove(filePath)
+		return nil, ErrNotFound
+	}
+	return &response, nil
+}
+
+func DeleteResponse(id string, userId int) error {
+	if _, err := GetResponse(id, userId); err != nil {
+		return err
+	}
+	filePath, err := responsePath(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filePath)
+}
+
+// ResponseHistory 按时间顺序返回 id 及之前所有响应的输入项和输出项，作为下一轮的上下文
+func ResponseHistory(id string, userId int) ([]json.RawMessage, error) {
+	var chain []*Response
+	for id != "" {
+		if len(chain) >= maxResponseChain {
+			return nil, errors.New("response chain is too long")
+		}
+		response, err := GetResponse(id, userId)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, response)
+		id = response.PreviousResponseId
+	}
+
+	var items []json.RawMessage
+	for i := len(chain) - 1; i >= 0; i-- {
+		items = append(items, chain[i].Input...)
+		items = append(items, chain[i].Output...)
+	}
+	return items, nil
+}
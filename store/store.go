@@ -0,0 +1,113 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+[INFO] 本地数据库：所有数据保存在一个 json 文件中，启动时整体加载到内存，每次修改后整体写回。
+网关的用户和令牌数量都不大，这样可以不依赖额外的数据库服务。
+每次请求都会扣减额度，额度的变化只修改内存，每隔 flushInterval 批量写回一次，进程异常退出时最多丢失这段时间内的扣减记录。
+*/
+
+var ErrNotFound = errors.New("record not found")
+
+const flushInterval = time.Second
+
+type data struct {
+	NextId int      `json:"next_id"`
+	Users  []*User  `json:"users"`
+	Tokens []*Token `json:"tokens"`
+}
+
+var (
+	mu   sync.RWMutex
+	path string
+	db   = &data{NextId: 1}
+	// key -> 令牌
+	tokenIndex = make(map[string]*Token)
+	// 内存中有还没有写回文件的修改
+	dirty     bool
+	flushOnce sync.Once
+)
+
+func Open(dbPath string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	path = dbPath
+	flushOnce.Do(func() { go flushLoop() })
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return save()
+	}
+	if err != nil {
+		return fmt.Errorf("read database file failed: %w", err)
+	}
+
+	newDB := &data{}
+	if err = json.Unmarshal(content, newDB); err != nil {
+		return fmt.Errorf("parse database file %s failed: %w", path, err)
+	}
+	if newDB.NextId <= 0 {
+		newDB.NextId = 1
+	}
+	db = newDB
+
+	tokenIndex = make(map[string]*Token, len(db.Tokens))
+	for _, token := range db.Tokens {
+		tokenIndex[token.Key] = token
+	}
+	return nil
+}
+
+func nextId() int {
+	id := db.NextId
+	db.NextId++
+	return id
+}
+
+// save 调用方需要持有写锁，先写临时文件再重命名，避免写一半时进程退出导致文件损坏
+func save() error {
+	content, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, content, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	dirty = false
+	return nil
+}
+
+// Flush 把内存中还没有写回的修改写回文件，退出前调用
+func Flush() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if !dirty {
+		return nil
+	}
+	return save()
+}
+
+// flushLoop 定时写回额度的变化，写入失败时保留修改，下次再写
+func flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		_ = Flush()
+	}
+}
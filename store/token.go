@@ -0,0 +1,149 @@
+package store
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"slices"
+	"time"
+)
+
+const (
+	TokenStatusEnabled  = 1
+	TokenStatusDisabled = 2
+)
+
+const (
+	tokenKeyPrefix = "sk-"
+	tokenKeyLength = 48
+	tokenKeyChars  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+var (
+	ErrTokenInvalid  = errors.New("token is invalid")
+	ErrTokenDisabled = errors.New("token is disabled")
+	ErrTokenExpired  = errors.New("token is expired")
+	ErrUserDisabled  = errors.New("user is disabled")
+)
+
+type Token struct {
+	Id             int      `json:"id"`
+	UserId         int      `json:"user_id"`
+	Key            string   `json:"key"`
+	Name           string   `json:"name"`
+	Status         int      `json:"status"`
+	RemainQuota    int64    `json:"remain_quota"`    //剩余额度
+	UsedQuota      int64    `json:"used_quota"`      //已用额度
+	UnlimitedQuota bool     `json:"unlimited_quota"` //不限额度，此时只受用户额度限制
+	CreatedAt      int64    `json:"created_at"`
+	ExpiredAt      int64    `json:"expired_at"`       //过期时间戳，-1 表示永不过期
+	Models         []string `json:"models,omitempty"` //可使用的模型，为空时不限制
+}
+
+func generateKey() (string, error) {
+	key := make([]byte, tokenKeyLength)
+	max := big.NewInt(int64(len(tokenKeyChars)))
+	for i := range key {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		key[i] = tokenKeyChars[n.Int64()]
+	}
+	return tokenKeyPrefix + string(key), nil
+}
+
+func CreateToken(userId int, name string, expiredAt int64, remainQuota int64, unlimitedQuota bool, models []string) (*Token, error) {
+	key, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	token := &Token{
+		Id:             nextId(),
+		UserId:         userId,
+		Key:            key,
+		Name:           name,
+		Status:         TokenStatusEnabled,
+		RemainQuota:    remainQuota,
+		UnlimitedQuota: unlimitedQuota,
+		CreatedAt:      time.Now().Unix(),
+		ExpiredAt:      expiredAt,
+		Models:         models,
+	}
+	db.Tokens = append(db.Tokens, token)
+	tokenIndex[token.Key] = token
+	if err = save(); err != nil {
+		// 写入失败时撤销修改，保持内存和文件一致
+		db.Tokens = db.Tokens[:len(db.Tokens)-1]
+		delete(tokenIndex, token.Key)
+		db.NextId--
+		return nil, err
+	}
+
+	clone := *token
+	return &clone, nil
+}
+
+// ValidateToken 校验令牌及其所属用户的状态
+func ValidateToken(key string) (*Token, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	token, ok := tokenIndex[key]
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+	if token.Status != TokenStatusEnabled {
+		return nil, ErrTokenDisabled
+	}
+	if token.ExpiredAt != -1 && token.ExpiredAt < time.Now().Unix() {
+		return nil, ErrTokenExpired
+	}
+	user := findUser(token.UserId)
+	if user == nil {
+		return nil, ErrTokenInvalid
+	}
+	if user.Status != UserStatusEnabled {
+		return nil, ErrUserDisabled
+	}
+	clone := *token
+	return &clone, nil
+}
+
+func ListTokens(userId int) []*Token {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	tokens := make([]*Token, 0)
+	for _, token := range db.Tokens {
+		if userId == 0 || token.UserId == userId {
+			clone := *token
+			tokens = append(tokens, &clone)
+		}
+	}
+	return tokens
+}
+
+func DeleteToken(id int) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, token := range db.Tokens {
+		if token.Id == id {
+			tokens := db.Tokens
+			db.Tokens = slices.Delete(slices.Clone(tokens), i, i+1)
+			delete(tokenIndex, token.Key)
+			if err := save(); err != nil {
+				db.Tokens = tokens
+				tokenIndex[token.Key] = token
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrUsernameExists = errors.New("username already exists")
+
+const (
+	RoleCommonUser = 1
+	RoleAdminUser  = 10
+)
+
+const (
+	UserStatusEnabled  = 1
+	UserStatusDisabled = 2
+)
+
+type User struct {
+	Id             int    `json:"id"`
+	Username       string `json:"username"`
+	Role           int    `json:"role"`
+	Status         int    `json:"status"`
+	Quota          int64  `json:"quota"`           //剩余额度
+	UsedQuota      int64  `json:"used_quota"`      //已用额度
+	UnlimitedQuota bool   `json:"unlimited_quota"` //不限额度
+	CreatedAt      int64  `json:"created_at"`
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role >= RoleAdminUser
+}
+
+func CreateUser(username string, role int, quota int64, unlimitedQuota bool) (*User, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, user := range db.Users {
+		if user.Username == username {
+			return nil, ErrUsernameExists
+		}
+	}
+	user := &User{
+		Id:             nextId(),
+		Username:       username,
+		Role:           role,
+		Status:         UserStatusEnabled,
+		Quota:          quota,
+		UnlimitedQuota: unlimitedQuota,
+		CreatedAt:      time.Now().Unix(),
+	}
+	db.Users = append(db.Users, user)
+	if err := save(); err != nil {
+		// 写入失败时撤销修改，保持内存和文件一致
+		db.Users = db.Users[:len(db.Users)-1]
+		db.NextId--
+		return nil, err
+	}
+
+	clone := *user
+	return &clone, nil
+}
+
+func GetUserById(id int) (*User, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if user := findUser(id); user != nil {
+		clone := *user
+		return &clone, nil
+	}
+	return nil, ErrNotFound
+}
+
+func ListUsers() []*User {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	users := make([]*User, 0, len(db.Users))
+	for _, user := range db.Users {
+		clone := *user
+		users = append(users, &clone)
+	}
+	return users
+}
+
+func CountUsers() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return len(db.Users)
+}
+
+// InitRootUser 数据库中没有用户时创建管理员和它的第一个令牌，已有用户时返回 nil
+func InitRootUser() (*Token, error) {
+	if CountUsers() > 0 {
+		return nil, nil
+	}
+
+	user, err := CreateUser("root", RoleAdminUser, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return CreateToken(user.Id, "root", -1, 0, true, nil)
+}
+
+// IncreaseUserQuota 给用户充值，delta 为负数时扣减
+func IncreaseUserQuota(id int, delta int64) (*User, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	user := findUser(id)
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	user.Quota += delta
+	if err := save(); err != nil {
+		user.Quota -= delta
+		return nil, err
+	}
+
+	clone := *user
+	return &clone, nil
+}
+
+func findUser(id int) *User {
+	for _, user := range db.Users {
+		if user.Id == id {
+			return user
+		}
+	}
+	return nil
+}